@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// expandArgsFile replaces a leading @FILE argument with the arguments read from FILE,
+// one per line, so long invocations need not fit on the command line. Blank lines
+// and # comments are skipped; arguments after @FILE are kept after the file's. A
+// .json file holds an object of flag names and values instead, as described by the
+// schema operation.
+func expandArgsFile(args []string) ([]string, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "@") {
+		return args, nil
+	}
+
+	path := strings.TrimPrefix(args[0], "@")
+	if filepath.Ext(path) == ".json" {
+		expanded, err := jsonArgs(path)
+		if err != nil {
+			return nil, err
+		}
+		return append(expanded, args[1:]...), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open arguments file: %w", err)
+	}
+	defer file.Close()
+
+	var expanded []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expanded = append(expanded, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read arguments file %s: %w", path, err)
+	}
+
+	return append(expanded, args[1:]...), nil
+}
+
+// jsonArgs turns a JSON arguments file into -name=value flags, one per array item for
+// repeatable flags. Unknown names are left for flag parsing to reject.
+func jsonArgs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open arguments file: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse arguments file %s: %w", path, err)
+	}
+
+	var expanded []string
+	for _, name := range sortedKeys(values) {
+		items, ok := values[name].([]interface{})
+		if !ok {
+			items = []interface{}{values[name]}
+		}
+		for _, item := range items {
+			var value string
+			switch v := item.(type) {
+			case string:
+				value = v
+			case bool:
+				value = strconv.FormatBool(v)
+			case float64:
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				return nil, fmt.Errorf("arguments file %s: unsupported value for %s", path, name)
+			}
+			expanded = append(expanded, fmt.Sprintf("-%s=%s", name, value))
+		}
+	}
+	return expanded, nil
+}
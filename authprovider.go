@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// parseAuthProvider parses a -auth-provider value of the form
+// name=NAME,key=value,... into the config of a legacy auth-provider plugin
+func parseAuthProvider(value string) (*api.AuthProviderConfig, error) {
+	provider := &api.AuthProviderConfig{Config: map[string]string{}}
+	for _, pair := range splitList(value) {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid auth provider setting %q, expected key=value", pair)
+		}
+		if key == "name" {
+			provider.Name = val
+			continue
+		}
+		provider.Config[key] = val
+	}
+
+	if provider.Name == "" {
+		return nil, fmt.Errorf("auth provider %q has no name=", value)
+	}
+	return provider, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// caCache holds the CA selected for each source cluster during this process, so that
+// generating for many ServiceAccounts (-sa -) reads and validates it, and warns about
+// it, only once
+var caCache = struct {
+	sync.Mutex
+	results map[string]caResult
+}{results: map[string]caResult{}}
+
+// caResult is the outcome of selecting a source cluster's CA
+type caResult struct {
+	data []byte
+	err  error
+}
+
+// cachedCertificateAuthority returns selectCertificateAuthority's result for the source
+// cluster, computing it on first use, and reports whether it came from the cache
+func cachedCertificateAuthority(source *api.Cluster, prefer string) ([]byte, bool, error) {
+	// Include the CA file's modification time so a rewritten file (e.g. with -watch) is re-read
+	var modified time.Time
+	if info, err := os.Stat(source.CertificateAuthority); err == nil {
+		modified = info.ModTime()
+	}
+	key := fmt.Sprintf("%s\x00%s\x00%s\x00%s", prefer, source.CertificateAuthority, modified, source.CertificateAuthorityData)
+
+	caCache.Lock()
+	defer caCache.Unlock()
+	if result, ok := caCache.results[key]; ok {
+		return result.data, true, result.err
+	}
+
+	data, err := selectCertificateAuthority(source, prefer)
+	caCache.results[key] = caResult{data: data, err: err}
+	return data, false, err
+}
+
+// caCandidate is one place a cluster's CA certificate can come from
+type caCandidate struct {
+	origin string
+	load   func() ([]byte, error)
+}
+
+// selectCertificateAuthority returns the first of the source cluster's inline CA data
+// and CA file, in -ca-prefer order, that holds valid PEM certificates
+func selectCertificateAuthority(source *api.Cluster, prefer string) ([]byte, error) {
+	var candidates []caCandidate
+	if len(source.CertificateAuthorityData) > 0 {
+		candidates = append(candidates, caCandidate{"certificate-authority-data", func() ([]byte, error) {
+			return source.CertificateAuthorityData, nil
+		}})
+	}
+	if source.CertificateAuthority != "" {
+		fileCandidate := caCandidate{"certificate-authority file " + source.CertificateAuthority, func() ([]byte, error) {
+			return os.ReadFile(source.CertificateAuthority)
+		}}
+		if prefer == "file" {
+			candidates = append([]caCandidate{fileCandidate}, candidates...)
+		} else {
+			candidates = append(candidates, fileCandidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no CA certificate data found")
+	}
+
+	for _, candidate := range candidates {
+		caData, err := candidate.load()
+		if err == nil {
+			caData, err = caBundle(caData)
+		}
+		if err == nil {
+			if len(candidates) > 1 {
+				logger.Infof("ca", "Using CA certificate from %s", candidate.origin)
+			}
+			return caData, nil
+		}
+		logger.Warnf("ca", "Ignoring CA certificate from %s: %v", candidate.origin, err)
+	}
+	return nil, fmt.Errorf("no valid CA certificate found")
+}
+
+// caBundle re-encodes every certificate of a PEM CA bundle, so that during CA rotation
+// the old and new CA both end up in the kubeconfig while other PEM blocks and stray
+// text are dropped
+func caBundle(data []byte) ([]byte, error) {
+	certs, err := certutil.ParseCertsPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 1 {
+		logger.Infof("ca", "CA bundle contains %d certificates, keeping all of them", len(certs))
+	}
+	return certutil.EncodeCertificates(certs...)
+}
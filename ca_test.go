@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// testCAPEM returns a PEM encoded self-signed CA certificate with the given common name
+func testCAPEM(t *testing.T, commonName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: commonName}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: cert.Raw})
+}
+
+func TestCABundle(t *testing.T) {
+	oldCA := testCAPEM(t, "old-ca")
+	newCA := testCAPEM(t, "new-ca")
+	keyBlock := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "multi-cert bundle",
+			data: append(append([]byte{}, oldCA...), newCA...),
+			want: []string{"old-ca", "new-ca"},
+		},
+		{
+			name: "trailing non-PEM block",
+			data: append(append(append([]byte{}, newCA...), keyBlock...), "# rotated 2024-01-01\n"...),
+			want: []string{"new-ca"},
+		},
+		{
+			name:    "empty input",
+			data:    nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := caBundle(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got bundle %q", bundle)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			certs, err := certutil.ParseCertsPEM(bundle)
+			if err != nil {
+				t.Fatalf("bundle does not parse: %v", err)
+			}
+			var got []string
+			for _, cert := range certs {
+				got = append(got, cert.Subject.CommonName)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got certificates %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("certificate %d is %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+			if bytes.Contains(bundle, []byte("PRIVATE KEY")) || bytes.Contains(bundle, []byte("rotated")) {
+				t.Errorf("bundle kept non-certificate data: %q", bundle)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// tokenCache holds tokens minted during this process when -cache-tokens is set,
+// so repeated generations for the same ServiceAccount reuse one TokenRequest
+var tokenCache = struct {
+	sync.Mutex
+	tokens map[string]string
+}{tokens: map[string]string{}}
+
+// tokenCacheKey identifies a token by source kubeconfig, cluster, server, namespace,
+// ServiceAccount, audiences and expiry, so each -kubeconfigs cluster mints its own
+func tokenCacheKey(config Config) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s/%s/%s/%d", config.KubeconfigPath, config.ClusterName, config.APIServer,
+		config.Namespace, config.ServiceAccountName, strings.Join(config.Audiences, ","), config.TokenExpiryHours)
+}
+
+// cachedToken returns a previously minted token for the configuration
+func cachedToken(config Config) (string, bool) {
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+	token, ok := tokenCache.tokens[tokenCacheKey(config)]
+	return token, ok
+}
+
+// cacheToken stores a minted token for reuse within this process
+func cacheToken(config Config, token string) {
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+	tokenCache.tokens[tokenCacheKey(config)] = token
+}
+
+// resetTokenCache forgets the minted tokens, e.g. before a -watch regeneration so
+// a refresh mints a new token rather than reusing the one nearing expiry
+func resetTokenCache() {
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+	tokenCache.tokens = map[string]string{}
+}
+
+// resolvedCluster is the cluster entry resolved for the generated kubeconfig: its
+// name, server and the source cluster its CA is taken from
+type resolvedCluster struct {
+	name          string
+	server        string
+	tlsServerName string
+	source        *api.Cluster
+}
+
+// clusterCache holds the clusters resolved during this process, so that generating
+// for many ServiceAccounts (-sa -) looks up the server, and warns about it, only once
+var clusterCache = struct {
+	sync.Mutex
+	clusters map[string]resolvedCluster
+}{clusters: map[string]resolvedCluster{}}
+
+// cachedCluster returns resolveCluster's result for the source cluster and server
+// flags, resolving it on first use. Failures are not cached.
+func cachedCluster(ctx context.Context, clientset *kubernetes.Clientset, config Config, currentContext *api.Context, currentCluster *api.Cluster) (resolvedCluster, error) {
+	key := fmt.Sprintf("%q", []string{
+		config.KubeconfigPath, currentContext.Cluster, currentCluster.Server, currentCluster.CertificateAuthority,
+		string(currentCluster.CertificateAuthorityData), config.ClusterName, config.ClusterPrefix,
+		fmt.Sprint(config.FromClusterInfo), fmt.Sprint(config.InClusterServer), config.Namespace, config.ServerSource,
+		config.APIServer, config.APIServerService, config.ServerHost, config.ServerPort, config.ResolveHostname,
+	})
+
+	clusterCache.Lock()
+	defer clusterCache.Unlock()
+	if cluster, ok := clusterCache.clusters[key]; ok {
+		return cluster, nil
+	}
+
+	cluster, err := resolveCluster(ctx, clientset, config, currentContext, currentCluster)
+	if err != nil {
+		return resolvedCluster{}, err
+	}
+	clusterCache.clusters[key] = cluster
+	return cluster, nil
+}
+
+// resetClusterCache forgets the resolved clusters, e.g. before a -watch regeneration
+// so a LoadBalancer address that has moved is picked up
+func resetClusterCache() {
+	clusterCache.Lock()
+	defer clusterCache.Unlock()
+	clusterCache.clusters = map[string]resolvedCluster{}
+}
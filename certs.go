@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// clientCertFromSecret reads a client certificate and key from a TLS Secret
+func clientCertFromSecret(ctx context.Context, clientset *kubernetes.Clientset, ref string) ([]byte, []byte, error) {
+	namespace, name, err := splitNamespacedName(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get secret %s: %w", ref, err)
+	}
+
+	cert, ok := secret.Data[corev1.TLSCertKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s not found in secret %s", corev1.TLSCertKey, ref)
+	}
+	key, ok := secret.Data[corev1.TLSPrivateKeyKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s not found in secret %s", corev1.TLSPrivateKeyKey, ref)
+	}
+
+	return cert, key, nil
+}
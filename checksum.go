@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeChecksum writes <path>.sha256 with the SHA-256 of the file at path, in the
+// format sha256sum -c verifies. The sidecar holds no secret and is world-readable.
+func writeChecksum(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for checksum: %w", path, err)
+	}
+
+	sum := sha256.Sum256(data)
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), filepath.Base(path))
+	if err := writeFileMode(path+".sha256", []byte(line), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum file: %w", err)
+	}
+	return nil
+}
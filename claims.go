@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// printTokenClaims pretty-prints the decoded claims of a token, noting opaque tokens
+func printTokenClaims(w io.Writer, token string) {
+	claims, err := kubetoken.Claims(token)
+	if err != nil {
+		fmt.Fprintf(w, "Token claims unavailable (opaque or legacy token): %v\n", err)
+		return
+	}
+
+	out, err := json.MarshalIndent(claims, "", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "Failed to format token claims: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(w, "Token claims:\n%s\n", out)
+}
+
+// checkTokenIssuer verifies a token's iss claim matches the expected issuer, if one is set
+func checkTokenIssuer(token, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	claims, err := kubetoken.Claims(token)
+	if err != nil {
+		return fmt.Errorf("cannot verify issuer: %w", err)
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if issuer != expected {
+		return fmt.Errorf("token was issued by %q, expected %q", issuer, expected)
+	}
+	return nil
+}
+
+// checkTokenServiceAccountUID verifies a bound token was issued for the ServiceAccount
+// with the expected UID, if one is set. Legacy tokens do not carry the UID claim.
+func checkTokenServiceAccountUID(token, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	claims, err := kubetoken.Claims(token)
+	if err != nil {
+		return fmt.Errorf("cannot verify ServiceAccount UID: %w", err)
+	}
+
+	kubernetesClaims, _ := claims["kubernetes.io"].(map[string]interface{})
+	serviceAccount, _ := kubernetesClaims["serviceaccount"].(map[string]interface{})
+	uid, ok := serviceAccount["uid"].(string)
+	if !ok {
+		// Legacy secret tokens carry the UID as a flat claim
+		uid, _ = claims["kubernetes.io/serviceaccount/service-account.uid"].(string)
+	}
+	if uid != expected {
+		return fmt.Errorf("token was issued for ServiceAccount UID %q, expected %q", uid, expected)
+	}
+	return nil
+}
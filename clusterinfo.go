@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// clusterInfoFromConfigMap reads the cluster embedded in the kubeadm-style
+// kube-public/cluster-info ConfigMap, which nodes use to discover the cluster
+func clusterInfoFromConfigMap(ctx context.Context, clientset *kubernetes.Clientset) (*api.Cluster, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(metav1.NamespacePublic).Get(ctx, "cluster-info", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster-info ConfigMap: %w", err)
+	}
+
+	data, ok := configMap.Data["kubeconfig"]
+	if !ok {
+		return nil, fmt.Errorf("cluster-info ConfigMap has no kubeconfig key")
+	}
+
+	infoConfig, err := clientcmd.Load([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig from cluster-info: %w", err)
+	}
+
+	for _, cluster := range infoConfig.Clusters {
+		return cluster, nil
+	}
+	return nil, fmt.Errorf("cluster-info kubeconfig has no clusters")
+}
+
+// rootCAConfigMap is the ConfigMap published in every namespace with the CA that
+// signs the API server's serving certificate for kubernetes.default.svc
+const rootCAConfigMap = "kube-root-ca.crt"
+
+// inClusterCertificateAuthority returns a copy of cluster trusting the root CA from
+// the namespace's kube-root-ca.crt ConfigMap, as pods do through their projected token
+func inClusterCertificateAuthority(ctx context.Context, clientset *kubernetes.Clientset, namespace string, cluster *api.Cluster) (*api.Cluster, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, rootCAConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s ConfigMap: %w", rootCAConfigMap, err)
+	}
+
+	data, ok := configMap.Data["ca.crt"]
+	if !ok {
+		return nil, fmt.Errorf("%s ConfigMap has no ca.crt key", rootCAConfigMap)
+	}
+
+	inCluster := cluster.DeepCopy()
+	inCluster.CertificateAuthority = ""
+	inCluster.CertificateAuthorityData = []byte(data)
+	inCluster.InsecureSkipTLSVerify = false
+	return inCluster, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// runCompare implements the compare operation, which diffs the RBAC rules of two ServiceAccounts
+func runCompare(ctx context.Context, args []string) error {
+	var config Config
+	var reviewNamespace string
+
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compare [flags] NAMESPACE/SA NAMESPACE/SA\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&config.KubeconfigPath, "kubeconfig", defaultKubeconfigPath(), "Path to the kubeconfig file")
+	flags.StringVar(&reviewNamespace, "review-namespace", "default", "Namespace to evaluate the rules in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected two ServiceAccounts, got %d", flags.NArg())
+	}
+
+	var rules [2]sets.Set[string]
+	for i, ref := range flags.Args() {
+		namespace, name, err := splitNamespacedName(ref)
+		if err != nil {
+			return err
+		}
+
+		saConfig := config
+		saConfig.ServiceAccountName = name
+		saConfig.Namespace = namespace
+
+		rules[i], err = serviceAccountRules(ctx, saConfig, reviewNamespace)
+		if err != nil {
+			return fmt.Errorf("failed to review rules for %s: %w", ref, err)
+		}
+	}
+
+	onlyFirst := sets.List(rules[0].Difference(rules[1]))
+	onlySecond := sets.List(rules[1].Difference(rules[0]))
+	if len(onlyFirst) == 0 && len(onlySecond) == 0 {
+		fmt.Printf("%s and %s have equivalent rules in namespace %s\n", flags.Arg(0), flags.Arg(1), reviewNamespace)
+		return nil
+	}
+
+	fmt.Printf("Rules in namespace %s:\n", reviewNamespace)
+	for _, rule := range onlyFirst {
+		fmt.Printf("- %s (only %s)\n", rule, flags.Arg(0))
+	}
+	for _, rule := range onlySecond {
+		fmt.Printf("+ %s (only %s)\n", rule, flags.Arg(1))
+	}
+
+	return nil
+}
+
+// newTokenClientset creates a clientset that authenticates to the configured cluster with token
+func newTokenClientset(config Config, token string) (*kubernetes.Clientset, error) {
+	clientConfig, err := clientcmd.BuildConfigFromFlags("", config.KubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from flags: %w", err)
+	}
+
+	tokenConfig := rest.AnonymousClientConfig(clientConfig)
+	tokenConfig.BearerToken = token
+	if err := configureClient(tokenConfig, config); err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(tokenConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	return clientset, nil
+}
+
+// newImpersonatingClientset creates a clientset that acts as the ServiceAccount
+// through impersonation, with the groups the API server gives its tokens
+func newImpersonatingClientset(config Config) (*kubernetes.Clientset, error) {
+	clientConfig, err := clientcmd.BuildConfigFromFlags("", config.KubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from flags: %w", err)
+	}
+
+	clientConfig.Impersonate = rest.ImpersonationConfig{
+		UserName: fmt.Sprintf("system:serviceaccount:%s:%s", config.Namespace, config.ServiceAccountName),
+		Groups: []string{
+			"system:serviceaccounts",
+			"system:serviceaccounts:" + config.Namespace,
+			"system:authenticated",
+		},
+	}
+	if err := configureClient(clientConfig, config); err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	return clientset, nil
+}
+
+// serviceAccountRules returns the allowed rules of the ServiceAccount in namespace,
+// flattened to one "verb resource" entry per permission. It reviews them while
+// impersonating the ServiceAccount, so no credentials are issued for it.
+func serviceAccountRules(ctx context.Context, config Config, namespace string) (sets.Set[string], error) {
+	saClientset, err := newImpersonatingClientset(config)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := saClientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx,
+		&authorizationv1.SelfSubjectRulesReview{
+			Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SelfSubjectRulesReview: %w", err)
+	}
+	if review.Status.Incomplete {
+		logger.Warnf("compare", "Rules for %s/%s are incomplete: %s",
+			config.Namespace, config.ServiceAccountName, review.Status.EvaluationError)
+	}
+
+	rules := sets.New[string]()
+	for _, rule := range review.Status.ResourceRules {
+		for _, verb := range rule.Verbs {
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					if group != "" {
+						resource = fmt.Sprintf("%s.%s", resource, group)
+					}
+					if len(rule.ResourceNames) == 0 {
+						rules.Insert(fmt.Sprintf("%s %s", verb, resource))
+					}
+					for _, name := range rule.ResourceNames {
+						rules.Insert(fmt.Sprintf("%s %s/%s", verb, resource, name))
+					}
+				}
+			}
+		}
+	}
+	for _, rule := range review.Status.NonResourceRules {
+		for _, verb := range rule.Verbs {
+			for _, url := range rule.NonResourceURLs {
+				rules.Insert(fmt.Sprintf("%s %s", verb, url))
+			}
+		}
+	}
+
+	return rules, nil
+}
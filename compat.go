@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// legacyDroppedFields are the fields, per kubeconfig section, that are newer than
+// what old clientcmd-based parsers accept and are removed by -schema-compat legacy
+var legacyDroppedFields = map[string][]string{
+	"clusters": {"extensions", "tls-server-name", "proxy-url", "disable-compression"},
+	"users":    {"extensions"},
+	"contexts": {"extensions"},
+}
+
+// legacyDroppedExecFields are removed from a user's exec block by -schema-compat legacy
+var legacyDroppedExecFields = []string{"interactiveMode", "provideClusterInfo"}
+
+// applyLegacyCompat rewrites serialized kubeconfig YAML for legacy consumers
+func applyLegacyCompat(data []byte) ([]byte, error) {
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	delete(document, "extensions")
+
+	for section, fields := range legacyDroppedFields {
+		entries, _ := document[section].([]interface{})
+		for _, entry := range entries {
+			named, _ := entry.(map[string]interface{})
+			// Entries nest their fields under the section's singular key
+			for _, value := range named {
+				body, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for _, field := range fields {
+					delete(body, field)
+				}
+				if exec, ok := body["exec"].(map[string]interface{}); ok {
+					for _, field := range legacyDroppedExecFields {
+						delete(exec, field)
+					}
+				}
+			}
+		}
+	}
+
+	return yaml.Marshal(document)
+}
+
+// writeCompatKubeconfig serializes the kubeconfig, applies the -schema-compat
+// transforms and writes the result to path
+func writeCompatKubeconfig(ctx context.Context, config Config, newConfig *api.Config, path string) error {
+	// Don't start writing once the operation has been cancelled
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not writing kubeconfig: %w", err)
+	}
+
+	data, err := clientcmd.Write(*newConfig)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	if data, err = applyLegacyCompat(data); err != nil {
+		return fmt.Errorf("failed to apply -schema-compat %s: %w", config.SchemaCompat, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := writeOutputFile(ctx, path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig to file: %w", err)
+	}
+
+	return nil
+}
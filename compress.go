@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// compressedAnnotation marks Secrets whose kubeconfig is stored gzip-compressed under <key>.gz
+const compressedAnnotation = "kubeconfig-generator/compressed"
+
+// gzipMagic are the leading bytes of gzip data
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressKubeconfig gzips serialized kubeconfig data
+func compressKubeconfig(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressKubeconfig returns data unchanged unless it is gzip-compressed
+func decompressKubeconfig(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress kubeconfig: %w", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress kubeconfig: %w", err)
+	}
+	return decompressed, nil
+}
+
+// secretKubeconfig reads the kubeconfig stored in a Secret under key, or
+// compressed under <key>.gz, and reports whether it was compressed
+func secretKubeconfig(secret *corev1.Secret, key string) ([]byte, bool, error) {
+	if data, ok := secret.Data[key+".gz"]; ok {
+		decompressed, err := decompressKubeconfig(data)
+		return decompressed, true, err
+	}
+
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, false, fmt.Errorf("key %s not found in secret %s/%s", key, secret.Namespace, secret.Name)
+	}
+	return data, false, nil
+}
+
+// storeSecretKubeconfig stores a kubeconfig in a Secret under key, or gzip-compressed
+// under <key>.gz with the compressed annotation set when compress is true
+func storeSecretKubeconfig(secret *corev1.Secret, key string, data []byte, compress bool) error {
+	if !compress {
+		delete(secret.Data, key+".gz")
+		delete(secret.Annotations, compressedAnnotation)
+		secret.Data[key] = data
+		return nil
+	}
+
+	compressed, err := compressKubeconfig(data)
+	if err != nil {
+		return fmt.Errorf("failed to compress kubeconfig: %w", err)
+	}
+	delete(secret.Data, key)
+	secret.Data[key+".gz"] = compressed
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[compressedAnnotation] = "true"
+	return nil
+}
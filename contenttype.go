@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// contentTypeExtensionName is the context extension carrying the recommended REST
+// content type. kubeconfig has no field for it, so client-go ignores it; downstream
+// tooling reads it and sets rest.Config.ContentType itself.
+const contentTypeExtensionName = "kubeconfig-generator/content-type"
+
+// contentTypes maps the -content-type values to their media types
+var contentTypes = map[string]string{
+	"json":     runtime.ContentTypeJSON,
+	"protobuf": runtime.ContentTypeProtobuf,
+}
+
+// stampContentType records the recommended content type on every context
+func stampContentType(newConfig *api.Config, contentType string) error {
+	mediaType, ok := contentTypes[contentType]
+	if !ok {
+		return fmt.Errorf("unsupported content type %q, expected json or protobuf", contentType)
+	}
+
+	raw := []byte(fmt.Sprintf("%q", mediaType))
+	for _, kubeContext := range newConfig.Contexts {
+		if kubeContext.Extensions == nil {
+			kubeContext.Extensions = map[string]runtime.Object{}
+		}
+		kubeContext.Extensions[contentTypeExtensionName] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// writeContextOnly adds or updates a single context tying an existing cluster and
+// user of the target kubeconfig to a namespace, leaving everything else untouched
+func writeContextOnly(ctx context.Context, config Config) (string, error) {
+	path := config.OutputPath
+	if config.Install {
+		path = installKubeconfigPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read kubeconfig %s: %w", path, err)
+	}
+	target, err := clientcmd.Load(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+	}
+
+	if _, ok := target.Clusters[config.ClusterName]; !ok {
+		return "", fmt.Errorf("cluster %s not found in %s", config.ClusterName, path)
+	}
+	if _, ok := target.AuthInfos[config.ContextUser]; !ok {
+		return "", fmt.Errorf("user %s not found in %s", config.ContextUser, path)
+	}
+
+	kubeContext := api.NewContext()
+	kubeContext.Cluster = config.ClusterName
+	kubeContext.AuthInfo = config.ContextUser
+	kubeContext.Namespace = config.Namespace
+	target.Contexts[config.ContextName] = kubeContext
+
+	return path, writeKubeconfig(ctx, target, path)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// runContexts implements the contexts operation, which lists the contexts of the
+// source kubeconfig that a kubeconfig can be generated from
+func runContexts(ctx context.Context, args []string) error {
+	var config Config
+
+	flags := flag.NewFlagSet("contexts", flag.ExitOnError)
+	flags.StringVar(&config.KubeconfigPath, "kubeconfig", defaultKubeconfigPath(), "Path to the kubeconfig file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	kubeconfig, err := clientcmd.LoadFromFile(config.KubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	return listContexts(os.Stdout, kubeconfig)
+}
+
+// listContexts prints a table of each context's cluster and server, marking the current one
+func listContexts(w io.Writer, kubeconfig *api.Config) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "CURRENT\tNAME\tCLUSTER\tSERVER")
+	for _, name := range sortedKeys(kubeconfig.Contexts) {
+		kubeContext := kubeconfig.Contexts[name]
+
+		current := ""
+		if name == kubeconfig.CurrentContext {
+			current = "*"
+		}
+		server := "(missing)"
+		if cluster := kubeconfig.Clusters[kubeContext.Cluster]; cluster != nil {
+			server = cluster.Server
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", current, name, kubeContext.Cluster, server)
+	}
+	return table.Flush()
+}
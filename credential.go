@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+)
+
+// runCredential implements the credential operation, the exec hook of kubeconfigs
+// generated with -store, which prints a stored token as an ExecCredential
+func runCredential(ctx context.Context, args []string) error {
+	var store, account string
+
+	flags := flag.NewFlagSet("credential", flag.ExitOnError)
+	flags.StringVar(&store, "store", "keyring", "Credential store the token was saved in")
+	flags.StringVar(&account, "account", "", "Account (cluster/user) the token was saved under")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if account == "" {
+		flags.Usage()
+		return fmt.Errorf("-account is required")
+	}
+
+	credentialStore, err := newCredentialStore(store)
+	if err != nil {
+		return err
+	}
+	token, err := credentialStore.Load(ctx, account)
+	if err != nil {
+		return fmt.Errorf("failed to load token for %s: %w", account, err)
+	}
+
+	credential := clientauthenticationv1.ExecCredential{
+		Status: &clientauthenticationv1.ExecCredentialStatus{Token: token},
+	}
+	credential.APIVersion = clientauthenticationv1.SchemeGroupVersion.String()
+	credential.Kind = "ExecCredential"
+	return json.NewEncoder(os.Stdout).Encode(credential)
+}
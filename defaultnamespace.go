@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// selfReviewGroups are the API groups every authenticated identity may use to ask
+// about itself; rules in them say nothing about access to a namespace
+var selfReviewGroups = map[string]bool{
+	"authorization.k8s.io":  true,
+	"authentication.k8s.io": true,
+}
+
+// contextNamespace returns the default namespace of the generated context, which is
+// the ServiceAccount's own namespace unless -default-namespace is set
+func contextNamespace(config Config) string {
+	if config.DefaultNamespace != "" {
+		return config.DefaultNamespace
+	}
+	return config.Namespace
+}
+
+// hasNamespaceAccess asks, as the ServiceAccount, whether it has any rules in
+// namespace beyond the self-review ones granted to everyone
+func hasNamespaceAccess(ctx context.Context, config Config, token, namespace string) (bool, error) {
+	clientset, err := newTokenClientset(config, token)
+	if err != nil {
+		return false, err
+	}
+
+	review, err := clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx,
+		&authorizationv1.SelfSubjectRulesReview{
+			Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create SelfSubjectRulesReview: %w", err)
+	}
+
+	for _, rule := range review.Status.ResourceRules {
+		for _, group := range rule.APIGroups {
+			if !selfReviewGroups[group] {
+				return true, nil
+			}
+		}
+	}
+	// Authorizers that cannot enumerate rules may still allow access
+	return review.Status.Incomplete, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// runDescribe implements the describe operation, which prints a security-relevant
+// summary of each context in a kubeconfig file
+func runDescribe(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("describe", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s describe KUBECONFIG\n", os.Args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a kubeconfig file")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	data, err = decompressKubeconfig(data)
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	describeKubeconfig(os.Stdout, kubeconfig)
+	return nil
+}
+
+// describeKubeconfig prints each context's server, TLS verification and credential type
+func describeKubeconfig(w io.Writer, kubeconfig *api.Config) {
+	for _, name := range sortedKeys(kubeconfig.Contexts) {
+		kubeContext := kubeconfig.Contexts[name]
+
+		current := ""
+		if name == kubeconfig.CurrentContext {
+			current = " (current)"
+		}
+		fmt.Fprintf(w, "Context: %s%s\n", name, current)
+		fmt.Fprintf(w, "  Namespace: %s\n", kubeContext.Namespace)
+
+		if cluster := kubeconfig.Clusters[kubeContext.Cluster]; cluster != nil {
+			fmt.Fprintf(w, "  Cluster:   %s (%s)\n", kubeContext.Cluster, cluster.Server)
+			fmt.Fprintf(w, "  TLS:       %s\n", describeTLS(cluster))
+		} else {
+			fmt.Fprintf(w, "  Cluster:   %s (missing)\n", kubeContext.Cluster)
+		}
+
+		if authInfo := kubeconfig.AuthInfos[kubeContext.AuthInfo]; authInfo != nil {
+			fmt.Fprintf(w, "  User:      %s (%s)\n", kubeContext.AuthInfo, describeAuthInfo(authInfo))
+		} else {
+			fmt.Fprintf(w, "  User:      %s (missing)\n", kubeContext.AuthInfo)
+		}
+	}
+}
+
+// describeTLS summarizes how a cluster's serving certificate is verified
+func describeTLS(cluster *api.Cluster) string {
+	switch {
+	case cluster.InsecureSkipTLSVerify:
+		return "insecure (certificate not verified)"
+	case len(cluster.CertificateAuthorityData) > 0:
+		return "CA embedded"
+	case cluster.CertificateAuthority != "":
+		return fmt.Sprintf("CA file %s", cluster.CertificateAuthority)
+	default:
+		return "system trust store"
+	}
+}
+
+// describeAuthInfo summarizes a user's credential type, including JWT expiry for tokens
+func describeAuthInfo(authInfo *api.AuthInfo) string {
+	switch {
+	case authInfo.Token != "":
+		expiry, err := kubetoken.Expiry(authInfo.Token)
+		if err != nil {
+			return "token, expiry unknown"
+		}
+		if time.Now().After(expiry) {
+			return fmt.Sprintf("token, expired %s", expiry.Format(time.RFC3339))
+		}
+		return fmt.Sprintf("token, expires %s", expiry.Format(time.RFC3339))
+	case authInfo.TokenFile != "":
+		return fmt.Sprintf("token file %s", authInfo.TokenFile)
+	case len(authInfo.ClientCertificateData) > 0 || authInfo.ClientCertificate != "":
+		return "client certificate"
+	case authInfo.Exec != nil:
+		return fmt.Sprintf("exec %s", authInfo.Exec.Command)
+	case authInfo.AuthProvider != nil:
+		return fmt.Sprintf("auth provider %s", authInfo.AuthProvider.Name)
+	case authInfo.Username != "":
+		return "basic auth"
+	default:
+		return "no credentials"
+	}
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
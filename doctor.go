@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os/exec"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// doctorCheck is a single environment check run by the doctor operation
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+}
+
+// runDoctor implements the doctor operation, which checks the environment for common problems
+func runDoctor(ctx context.Context, args []string) error {
+	var config Config
+
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.StringVar(&config.KubeconfigPath, "kubeconfig", defaultKubeconfigPath(), "Path to the kubeconfig file")
+	flags.StringVar(&config.Namespace, "namespace", "default", "Namespace to check token creation permissions in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var clientset *kubernetes.Clientset
+	checks := []doctorCheck{
+		{"kubectl available", func() (string, error) {
+			return kubectlClientVersion(ctx)
+		}},
+		{"kubeconfig readable", func() (string, error) {
+			kubeconfig, err := clientcmd.LoadFromFile(config.KubeconfigPath)
+			if err != nil {
+				return "", err
+			}
+			if kubeconfig.CurrentContext == "" {
+				return "", fmt.Errorf("%s has no current context", config.KubeconfigPath)
+			}
+			return fmt.Sprintf("%s (current context %s)", config.KubeconfigPath, kubeconfig.CurrentContext), nil
+		}},
+		{"current context reachable", func() (string, error) {
+			var err error
+			if clientset, err = newClientset(config); err != nil {
+				return "", err
+			}
+			info, err := clientset.Discovery().ServerVersion()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("server %s", info.GitVersion), nil
+		}},
+		{"TokenRequest API supported", func() (string, error) {
+			if clientset == nil {
+				return "", fmt.Errorf("cluster not reachable")
+			}
+			resources, err := clientset.Discovery().ServerResourcesForGroupVersion("v1")
+			if err != nil {
+				return "", err
+			}
+			for _, resource := range resources.APIResources {
+				if resource.Name == "serviceaccounts/token" {
+					return "serviceaccounts/token is served", nil
+				}
+			}
+			return "", fmt.Errorf("serviceaccounts/token is not served, legacy secret tokens will be used")
+		}},
+		{"can create tokens", func() (string, error) {
+			if clientset == nil {
+				return "", fmt.Errorf("cluster not reachable")
+			}
+			review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx,
+				&authorizationv1.SelfSubjectAccessReview{
+					Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+						ResourceAttributes: &authorizationv1.ResourceAttributes{
+							Namespace:   config.Namespace,
+							Verb:        "create",
+							Resource:    "serviceaccounts",
+							Subresource: "token",
+						},
+					},
+				},
+				metav1.CreateOptions{},
+			)
+			if err != nil {
+				return "", err
+			}
+			if !review.Status.Allowed {
+				return "", fmt.Errorf("not allowed to create serviceaccounts/token in namespace %s", config.Namespace)
+			}
+			return fmt.Sprintf("allowed in namespace %s", config.Namespace), nil
+		}},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		if err != nil {
+			failed++
+			fmt.Printf("[FAIL] %s: %v\n", check.name, err)
+			continue
+		}
+		fmt.Printf("[PASS] %s: %s\n", check.name, detail)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// kubectlClientVersion returns the version of the kubectl binary on the PATH
+func kubectlClientVersion(ctx context.Context) (string, error) {
+	path, err := exec.LookPath("kubectl")
+	if err != nil {
+		return "", err
+	}
+
+	gitVersion, err := cliClientVersion(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s (%s)", path, gitVersion), nil
+}
+
+// cliClientVersion returns the client gitVersion reported by kubectl or oc
+func cliClientVersion(ctx context.Context, binary string) (string, error) {
+	out, err := exec.CommandContext(ctx, binary, "version", "--client", "-o", "json").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s version: %w", binary, err)
+	}
+
+	var version struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(out, &version); err != nil {
+		return "", fmt.Errorf("failed to parse %s version: %w", binary, err)
+	}
+
+	return version.ClientVersion.GitVersion, nil
+}
+
+// checkCLIVersion fails when the kubectl (or oc) client is older than minimum
+func checkCLIVersion(ctx context.Context, config Config, minimum string) error {
+	required, err := utilversion.ParseGeneric(minimum)
+	if err != nil {
+		return fmt.Errorf("invalid -require-kubectl-version %q: %w", minimum, err)
+	}
+
+	gitVersion, err := cliClientVersion(ctx, cliBinary(config))
+	if err != nil {
+		return err
+	}
+	actual, err := utilversion.ParseGeneric(gitVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s version %q: %w", cliBinary(config), gitVersion, err)
+	}
+
+	if actual.LessThan(required) {
+		return fmt.Errorf("%s %s is older than the required %s", cliBinary(config), gitVersion, minimum)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// runDrift implements the drift operation, which compares the server and CA of a
+// stored kubeconfig with those of the live cluster in the admin kubeconfig
+func runDrift(ctx context.Context, args []string) error {
+	var config Config
+
+	flags := flag.NewFlagSet("drift", flag.ExitOnError)
+	flags.StringVar(&config.KubeconfigPath, "kubeconfig", defaultKubeconfigPath(), "Path to the admin kubeconfig whose current context is the live cluster")
+	flags.StringVar(&config.CAPrefer, "ca-prefer", "data", "Which CA source of the live cluster to try first: data or file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s drift [-kubeconfig ADMIN] STORED-KUBECONFIG\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a stored kubeconfig file")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read stored kubeconfig: %w", err)
+	}
+	if data, err = decompressKubeconfig(data); err != nil {
+		return err
+	}
+	stored, err := clientcmd.Load(data)
+	if err != nil {
+		return fmt.Errorf("failed to load stored kubeconfig: %w", err)
+	}
+	storedCluster, err := currentCluster(stored)
+	if err != nil {
+		return fmt.Errorf("stored kubeconfig: %w", err)
+	}
+
+	admin, err := clientcmd.LoadFromFile(config.KubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load admin kubeconfig: %w", err)
+	}
+	liveCluster, err := currentCluster(admin)
+	if err != nil {
+		return fmt.Errorf("admin kubeconfig: %w", err)
+	}
+
+	if drifted := reportDrift(os.Stdout, storedCluster, liveCluster, config); drifted > 0 {
+		return fmt.Errorf("%d difference(s) found, regenerate %s", drifted, flags.Arg(0))
+	}
+	return nil
+}
+
+// currentCluster returns the cluster of a kubeconfig's current context
+func currentCluster(kubeconfig *api.Config) (*api.Cluster, error) {
+	kubeContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if kubeContext == nil {
+		return nil, fmt.Errorf("no current context found")
+	}
+	cluster := kubeconfig.Clusters[kubeContext.Cluster]
+	if cluster == nil {
+		return nil, fmt.Errorf("cluster %s of context %s not found", kubeContext.Cluster, kubeconfig.CurrentContext)
+	}
+	return cluster, nil
+}
+
+// reportDrift prints how the stored cluster's server and CA compare with the live
+// cluster's and returns the number of differences
+func reportDrift(w io.Writer, stored, live *api.Cluster, config Config) int {
+	drifted := 0
+
+	if stored.Server == live.Server {
+		fmt.Fprintf(w, "Server: unchanged (%s)\n", stored.Server)
+	} else {
+		drifted++
+		fmt.Fprintf(w, "Server: DRIFTED (stored %s, live %s)\n", stored.Server, live.Server)
+	}
+
+	liveCA, err := selectCertificateAuthority(live, config.CAPrefer)
+	switch {
+	case stored.InsecureSkipTLSVerify || len(stored.CertificateAuthorityData) == 0:
+		fmt.Fprintf(w, "CA:     not embedded in the stored kubeconfig\n")
+	case err != nil:
+		fmt.Fprintf(w, "CA:     live CA unavailable: %v\n", err)
+	default:
+		storedCA, err := caBundle(stored.CertificateAuthorityData)
+		if err == nil && bytes.Equal(storedCA, liveCA) {
+			fmt.Fprintf(w, "CA:     unchanged\n")
+		} else {
+			drifted++
+			fmt.Fprintf(w, "CA:     DRIFTED (the live cluster's CA differs from the stored one)\n")
+		}
+	}
+
+	return drifted
+}
@@ -0,0 +1,12 @@
+package main
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// dryRun returns the DryRun option for create and update calls, which makes the
+// API server run admission without persisting anything when -server-dry-run is set
+func dryRun(config Config) []string {
+	if config.ServerDryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
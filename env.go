@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// outputKubeconfigPath returns the path the generated kubeconfig was written to
+func outputKubeconfigPath(config Config) string {
+	switch {
+	case config.Install:
+		return installKubeconfigPath()
+	case config.SplitOutputDir != "":
+		return filepath.Join(config.SplitOutputDir, "kubeconfig")
+	case config.PreviewPath != "":
+		return config.PreviewPath
+	default:
+		return config.OutputPath
+	}
+}
+
+// shellQuote quotes a value for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// writeEnvFile writes a sourceable file exporting KUBECONFIG, and KUBE_TOKEN with -env-include-token
+func writeEnvFile(ctx context.Context, config Config, newConfig *api.Config) error {
+	kubeconfigPath, err := filepath.Abs(outputKubeconfigPath(config))
+	if err != nil {
+		return fmt.Errorf("failed to resolve kubeconfig path: %w", err)
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "export KUBECONFIG=%s\n", shellQuote(kubeconfigPath))
+
+	// The file holds a credential when the token is included, so keep it private
+	perm := os.FileMode(0644)
+	if config.EnvIncludeToken {
+		if authInfo := newConfig.AuthInfos[authInfoName(config)]; authInfo != nil && authInfo.Token != "" {
+			fmt.Fprintf(&content, "export KUBE_TOKEN=%s\n", shellQuote(authInfo.Token))
+			perm = 0600
+		}
+	}
+
+	if err := writeOutputFile(ctx, config.EnvOutput, []byte(content.String()), perm); err != nil {
+		return fmt.Errorf("failed to write environment file: %w", err)
+	}
+	return nil
+}
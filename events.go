@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventReason is the reason of the Events recorded with -emit-events
+const eventReason = "KubeconfigGenerationWarning"
+
+// emitWarningEvents records each warning logged during generation as a Warning
+// Event on the ServiceAccount, so it shows up in kubectl describe sa
+func emitWarningEvents(ctx context.Context, config Config, warnings []string) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	clientset, err := newClientset(config)
+	if err != nil {
+		return err
+	}
+	sa, err := clientset.CoreV1().ServiceAccounts(config.Namespace).Get(ctx, config.ServiceAccountName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ServiceAccount %s: %w", config.ServiceAccountName, err)
+	}
+
+	now := metav1.NewTime(time.Now())
+	for _, warning := range warnings {
+		event := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: sa.Name + ".",
+				Namespace:    sa.Namespace,
+			},
+			InvolvedObject: corev1.ObjectReference{
+				APIVersion:      "v1",
+				Kind:            "ServiceAccount",
+				Namespace:       sa.Namespace,
+				Name:            sa.Name,
+				UID:             sa.UID,
+				ResourceVersion: sa.ResourceVersion,
+			},
+			Reason:         eventReason,
+			Message:        warning,
+			Type:           corev1.EventTypeWarning,
+			Source:         corev1.EventSource{Component: "kubeconfig-generator"},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if _, err := clientset.CoreV1().Events(sa.Namespace).Create(ctx, event, metav1.CreateOptions{DryRun: dryRun(config)}); err != nil {
+			return fmt.Errorf("failed to create Event: %w", err)
+		}
+	}
+	return nil
+}
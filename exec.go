@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// supportedExecAPIVersions are the ExecCredential versions client-go understands
+var supportedExecAPIVersions = []string{
+	"client.authentication.k8s.io/v1",
+	"client.authentication.k8s.io/v1beta1",
+}
+
+// execConfig builds an exec credential plugin configuration from the -exec-* flags
+func execConfig(config Config) (*api.ExecConfig, error) {
+	supported := false
+	for _, version := range supportedExecAPIVersions {
+		if config.ExecAPIVersion == version {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("unsupported exec API version %q, expected one of %s",
+			config.ExecAPIVersion, strings.Join(supportedExecAPIVersions, ", "))
+	}
+
+	exec := &api.ExecConfig{
+		Command:         config.ExecCommand,
+		Args:            config.ExecArgs,
+		APIVersion:      config.ExecAPIVersion,
+		InteractiveMode: api.IfAvailableExecInteractiveMode,
+	}
+	for _, env := range config.ExecEnv {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid exec environment variable %q, expected NAME=VALUE", env)
+		}
+		exec.Env = append(exec.Env, api.ExecEnvVar{Name: name, Value: value})
+	}
+
+	return exec, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Generator generates a kubeconfig for a ServiceAccount and writes it to its
+// destination
+type Generator struct {
+	Config Config
+
+	// Kubeconfig is the generated kubeconfig, set once Generate succeeds
+	Kubeconfig *api.Config
+}
+
+// NewGenerator creates a Generator for the given configuration
+func NewGenerator(config Config) *Generator {
+	return &Generator{Config: config}
+}
+
+// Generate assembles the kubeconfig, checks and validates the result and writes it
+func (g *Generator) Generate(ctx context.Context) error {
+	var newConfig *api.Config
+	revokeGrant := func() {}
+	var err error
+	if g.Config.FromMountedToken {
+		newConfig, err = generateFromMountedToken(g.Config)
+	} else if len(g.Config.Kubeconfigs) > 0 {
+		newConfig, revokeGrant, err = generateAcrossKubeconfigs(ctx, g.Config)
+	} else {
+		newConfig, revokeGrant, err = generateKubeconfig(ctx, g.Config)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A -grant-verbs grant is only kept once the kubeconfig that relies on it is written
+	if err := g.checkAndWrite(ctx, newConfig); err != nil {
+		revokeGrant()
+		return err
+	}
+	return nil
+}
+
+// checkAndWrite applies the checks to an assembled kubeconfig and writes it
+// with its companion files. Tokens are only handed to a -store once every check has
+// passed, so a rejected kubeconfig leaves nothing behind.
+func (g *Generator) checkAndWrite(ctx context.Context, newConfig *api.Config) error {
+	// Hint the preferred wire format to clients reading the kubeconfig
+	if g.Config.ContentType != "" {
+		if err := stampContentType(newConfig, g.Config.ContentType); err != nil {
+			return err
+		}
+	}
+
+	if err := checkKubeconfig(g.Config, newConfig); err != nil {
+		return err
+	}
+
+	// A warning promoted by -strict fails the generation before anything is written
+	if err := logger.StrictError(); err != nil {
+		return err
+	}
+
+	// Nothing is persisted with -server-dry-run
+	if g.Config.ServerDryRun {
+		g.Kubeconfig = newConfig
+		return nil
+	}
+
+	// Refuse an exposed output directory before any token leaves the process
+	if err := checkOutputLocation(g.Config); err != nil {
+		return err
+	}
+
+	// Keep tokens out of the file, leaving an exec hook that reads them back
+	if g.Config.Store != "" && g.Config.Store != "file" {
+		if err := moveTokensToStore(ctx, g.Config, newConfig); err != nil {
+			return err
+		}
+	}
+
+	if err := outputKubeconfig(ctx, g.Config, newConfig); err != nil {
+		return err
+	}
+	g.Kubeconfig = newConfig
+
+	// Document what the credentials allow next to the kubeconfig
+	if g.Config.EmitRBAC != "" {
+		clientset, err := newClientset(g.Config)
+		if err != nil {
+			return err
+		}
+		if err := emitRBAC(ctx, clientset, g.Config); err != nil {
+			return err
+		}
+	}
+
+	// Write a sourceable environment file pointing at the output
+	if g.Config.EnvOutput != "" {
+		if err := writeEnvFile(ctx, g.Config, newConfig); err != nil {
+			return err
+		}
+	}
+	return logger.StrictError()
+}
+
+// checkKubeconfig applies -fail-on-insecure, structural validation and -policy to a
+// kubeconfig about to be written, whichever path produced it
+func checkKubeconfig(config Config, newConfig *api.Config) error {
+	// Enforce CA-backed clusters
+	if config.FailOnInsecure {
+		for name, cluster := range newConfig.Clusters {
+			if cluster.InsecureSkipTLSVerify {
+				return fmt.Errorf("cluster %s skips TLS verification, refusing to write it with -fail-on-insecure", name)
+			}
+		}
+	}
+
+	// Catch structural problems such as dangling references before anything is written
+	if err := clientcmd.Validate(*newConfig); err != nil {
+		return fmt.Errorf("generated kubeconfig is invalid: %w", err)
+	}
+
+	// Enforce organizational rules, including under -server-dry-run
+	evaluation := policyContext{config: config, now: time.Now()}
+	for _, spec := range config.Policies {
+		policy, err := parsePolicy(spec)
+		if err != nil {
+			return err
+		}
+		if err := policy(newConfig, evaluation); err != nil {
+			return fmt.Errorf("rejected by policy: %w", err)
+		}
+	}
+	return nil
+}
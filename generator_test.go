@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// testToken builds an unsigned JWT with the given expiry
+func testToken(expiry time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." +
+		encode([]byte(fmt.Sprintf(`{"exp":%d}`, expiry.Unix()))) + "."
+}
+
+// testKubeconfig returns a kubeconfig with one context whose user holds token
+func testKubeconfig(token string) *api.Config {
+	kubeconfig := api.NewConfig()
+	kubeconfig.Clusters["test"] = &api.Cluster{Server: "https://127.0.0.1:6443", CertificateAuthorityData: []byte("ca")}
+	kubeconfig.AuthInfos["app"] = &api.AuthInfo{Token: token}
+	kubeconfig.Contexts["app-context"] = &api.Context{Cluster: "test", AuthInfo: "app", Namespace: "default"}
+	kubeconfig.CurrentContext = "app-context"
+	return kubeconfig
+}
+
+func TestCheckAndWritePolicyBeforeStore(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "kubeconfig")
+	token := testToken(time.Now().Add(10 * time.Hour))
+	newConfig := testKubeconfig(token)
+
+	g := NewGenerator(Config{
+		OutputPath:     output,
+		Store:          "keyring",
+		Policies:       []string{"max-expiry=1h"},
+		OutputDirCheck: "off",
+	})
+	err := g.checkAndWrite(context.Background(), newConfig)
+	if err == nil || !strings.Contains(err.Error(), "rejected by policy") {
+		t.Fatalf("expected a policy rejection, got %v", err)
+	}
+
+	// The token must not have been moved to the keyring behind an exec hook
+	authInfo := newConfig.AuthInfos["app"]
+	if authInfo.Token != token || authInfo.Exec != nil {
+		t.Errorf("token was handed to the store before the policy ran: %+v", authInfo)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("expected no kubeconfig at %s, got %v", output, err)
+	}
+}
+
+func TestCheckAndWriteStrictOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "kubeconfig")
+	token := testToken(time.Now().Add(time.Hour))
+	newConfig := testKubeconfig(token)
+
+	g := NewGenerator(Config{
+		OutputPath:     output,
+		Store:          "keyring",
+		Strict:         true,
+		OutputDirCheck: "warn",
+	})
+	err := g.checkAndWrite(context.Background(), newConfig)
+	if err == nil || !strings.Contains(err.Error(), "world-readable") {
+		t.Fatalf("expected the world-readable directory to be refused, got %v", err)
+	}
+
+	if authInfo := newConfig.AuthInfos["app"]; authInfo.Token != token || authInfo.Exec != nil {
+		t.Errorf("token was handed to the store before the directory check: %+v", authInfo)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("expected no kubeconfig at %s, got %v", output, err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// validGrantVerbs are the verbs accepted by -grant-verbs
+var validGrantVerbs = sets.New("get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "*")
+
+// grantRules builds the policy rule for -grant-verbs and -grant-resources. Resources
+// may be qualified with their API group, e.g. deployments.apps.
+func grantRules(verbs, resources []string) ([]rbacv1.PolicyRule, error) {
+	for _, verb := range verbs {
+		if !validGrantVerbs.Has(verb) {
+			return nil, fmt.Errorf("invalid verb %q, expected one of %s", verb, strings.Join(sets.List(validGrantVerbs), ","))
+		}
+	}
+
+	// Group resources by API group, one rule per group
+	var groups []string
+	byGroup := map[string][]string{}
+	for _, resource := range resources {
+		name, group, _ := strings.Cut(resource, ".")
+		if name == "" {
+			return nil, fmt.Errorf("invalid resource %q", resource)
+		}
+		if _, ok := byGroup[group]; !ok {
+			groups = append(groups, group)
+		}
+		byGroup[group] = append(byGroup[group], name)
+	}
+
+	var rules []rbacv1.PolicyRule
+	for _, group := range groups {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{group},
+			Resources: byGroup[group],
+			Verbs:     verbs,
+		})
+	}
+	return rules, nil
+}
+
+// grantName is the name of the Role and RoleBinding created for the ServiceAccount
+func grantName(config Config) string {
+	return fmt.Sprintf("kubeconfig-generator-%s", config.ServiceAccountName)
+}
+
+// grantAccess creates a Role with the requested rules and binds it to the
+// ServiceAccount, updating both in place when an earlier run (or a -watch
+// regeneration) already created them. The returned function deletes the objects
+// this call created again; ones that already existed are left alone.
+func grantAccess(ctx context.Context, clientset *kubernetes.Clientset, config Config) (func(), error) {
+	rules, err := grantRules(config.GrantVerbs, config.GrantResources)
+	if err != nil {
+		return nil, err
+	}
+
+	name := grantName(config)
+	roles := clientset.RbacV1().Roles(config.Namespace)
+	bindings := clientset.RbacV1().RoleBindings(config.Namespace)
+
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: config.Namespace},
+		Rules:      rules,
+	}
+	roleCreated := true
+	_, err = roles.Create(ctx, role, metav1.CreateOptions{DryRun: dryRun(config)})
+	if apierrors.IsAlreadyExists(err) {
+		roleCreated = false
+		var existing *rbacv1.Role
+		if existing, err = roles.Get(ctx, name, metav1.GetOptions{}); err == nil {
+			existing.Rules = rules
+			_, err = roles.Update(ctx, existing, metav1.UpdateOptions{DryRun: dryRun(config)})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Role %s: %w", name, err)
+	}
+
+	deleteRole := func() {
+		if !roleCreated {
+			return
+		}
+		if err := roles.Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+			logger.Warnf("grant", "Failed to clean up Role %s: %v", name, err)
+		}
+	}
+
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      config.ServiceAccountName,
+		Namespace: config.Namespace,
+	}}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: config.Namespace},
+		Subjects:   subjects,
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+	}
+	bindingCreated := true
+	_, err = bindings.Create(ctx, binding, metav1.CreateOptions{DryRun: dryRun(config)})
+	if apierrors.IsAlreadyExists(err) {
+		// The roleRef is immutable, but it always points at the Role of the same name
+		bindingCreated = false
+		var existing *rbacv1.RoleBinding
+		if existing, err = bindings.Get(ctx, name, metav1.GetOptions{}); err == nil {
+			existing.Subjects = subjects
+			_, err = bindings.Update(ctx, existing, metav1.UpdateOptions{DryRun: dryRun(config)})
+		}
+	}
+	if err != nil {
+		if !config.ServerDryRun {
+			deleteRole()
+		}
+		return nil, fmt.Errorf("failed to create RoleBinding %s: %w", name, err)
+	}
+
+	// Nothing was persisted, so there is nothing to clean up
+	if config.ServerDryRun {
+		logger.Infof("grant", "Role and RoleBinding %s in namespace %s pass admission (server dry-run)", name, config.Namespace)
+		return func() {}, nil
+	}
+
+	if roleCreated || bindingCreated {
+		logger.Infof("grant", "Created Role and RoleBinding %s in namespace %s", name, config.Namespace)
+	} else {
+		logger.Infof("grant", "Updated Role and RoleBinding %s in namespace %s", name, config.Namespace)
+	}
+
+	return func() {
+		if bindingCreated {
+			if err := bindings.Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+				logger.Warnf("grant", "Failed to clean up RoleBinding %s: %v", name, err)
+			}
+		}
+		deleteRole()
+	}, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// splitNamespacedName parses a namespace/name reference
+func splitNamespacedName(ref string) (string, string, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid reference %q, expected namespace/name", ref)
+	}
+	return namespace, name, nil
+}
+
+// fetchSpokeKubeconfig reads a spoke cluster's kubeconfig from a Secret in the hub
+// cluster and writes it to a private temporary file. The returned cleanup function
+// removes the file.
+func fetchSpokeKubeconfig(ctx context.Context, config Config) (string, func(), error) {
+	namespace, name, err := splitNamespacedName(config.HubSecret)
+	if err != nil {
+		return "", nil, err
+	}
+
+	hubClientset, err := newClientset(config)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to connect to hub cluster: %w", err)
+	}
+
+	secret, err := hubClientset.CoreV1().Secrets(namespace).Get(
+		ctx,
+		name,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get hub secret %s: %w", config.HubSecret, err)
+	}
+
+	data, _, err := secretKubeconfig(secret, config.HubSecretKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// CreateTemp creates the file with 0600 permissions
+	file, err := os.CreateTemp("", "spoke-kubeconfig-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary kubeconfig: %w", err)
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temporary kubeconfig: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temporary kubeconfig: %w", err)
+	}
+
+	return file.Name(), cleanup, nil
+}
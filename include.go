@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// includedAuth is an extra user entry requested with -include-auth
+type includedAuth struct {
+	name   string
+	kind   string // token or cert
+	source string // ServiceAccount for token, namespace/name of a TLS Secret for cert
+}
+
+// parseIncludeAuth parses -include-auth values of the form name=token[:sa] or
+// name=cert:namespace/secret
+func parseIncludeAuth(values []string, config Config) ([]includedAuth, error) {
+	var auths []includedAuth
+	for _, value := range values {
+		name, spec, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid -include-auth %q, expected name=token[:sa] or name=cert:namespace/secret", value)
+		}
+
+		kind, source, _ := strings.Cut(spec, ":")
+		switch kind {
+		case "token":
+			if source == "" {
+				source = config.ServiceAccountName
+			}
+		case "cert":
+			if _, _, err := splitNamespacedName(source); err != nil {
+				return nil, fmt.Errorf("invalid -include-auth %q: %w", value, err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid -include-auth %q, expected name=token[:sa] or name=cert:namespace/secret", value)
+		}
+
+		auths = append(auths, includedAuth{name: name, kind: kind, source: source})
+	}
+	return auths, nil
+}
+
+// addIncludedAuthInfos adds a user entry for each -include-auth source, without any
+// context referencing it, for consumers that pick a credential themselves
+func addIncludedAuthInfos(ctx context.Context, clientset *kubernetes.Clientset, config Config, newConfig *api.Config) error {
+	auths, err := parseIncludeAuth(config.IncludeAuth, config)
+	if err != nil {
+		return err
+	}
+
+	for _, auth := range auths {
+		if _, exists := newConfig.AuthInfos[auth.name]; exists {
+			return fmt.Errorf("-include-auth user %s already exists in the kubeconfig", auth.name)
+		}
+
+		switch auth.kind {
+		case "token":
+			tokenConfig := config
+			tokenConfig.ServiceAccountName = auth.source
+			token, err := getServiceAccountToken(ctx, clientset, tokenConfig)
+			if err != nil {
+				return fmt.Errorf("failed to get token for -include-auth user %s: %w", auth.name, err)
+			}
+			newConfig.AuthInfos[auth.name] = &api.AuthInfo{Token: token}
+		case "cert":
+			cert, key, err := clientCertFromSecret(ctx, clientset, auth.source)
+			if err != nil {
+				return fmt.Errorf("-include-auth user %s: %w", auth.name, err)
+			}
+			newConfig.AuthInfos[auth.name] = &api.AuthInfo{ClientCertificateData: cert, ClientKeyData: key}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// installKubeconfigPath returns the user's default kubeconfig, honoring KUBECONFIG
+func installKubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		if paths := filepath.SplitList(env); len(paths) > 0 && paths[0] != "" {
+			return paths[0]
+		}
+	}
+	return defaultKubeconfigPath()
+}
+
+// mergeKubeconfig merges the clusters, users and contexts of src into dst, resolving
+// name collisions with the -merge-strategy: skip keeps the existing entry, overwrite
+// replaces it and rename adds the new entry under a numeric suffix. dst's
+// current-context is only replaced when switchContext is set or dst has none.
+func mergeKubeconfig(dst, src *api.Config, strategy string, switchContext bool) {
+	clusterNames := mergeEntries("cluster", dst.Clusters, src.Clusters, strategy)
+	authInfoNames := mergeEntries("user", dst.AuthInfos, src.AuthInfos, strategy)
+
+	// Point the new contexts at their clusters and users under their merged names
+	contexts := make(map[string]*api.Context, len(src.Contexts))
+	for name, kubeContext := range src.Contexts {
+		merged := *kubeContext
+		merged.Cluster = mergedName(clusterNames, kubeContext.Cluster)
+		merged.AuthInfo = mergedName(authInfoNames, kubeContext.AuthInfo)
+		contexts[name] = &merged
+	}
+	contextNames := mergeEntries("context", dst.Contexts, contexts, strategy)
+
+	if src.CurrentContext != "" && (switchContext || dst.CurrentContext == "") {
+		dst.CurrentContext = mergedName(contextNames, src.CurrentContext)
+	}
+}
+
+// mergeEntries adds the src entries to dst according to strategy and returns the
+// name each src entry is found under in dst
+func mergeEntries[V any](kind string, dst, src map[string]V, strategy string) map[string]string {
+	names := make(map[string]string, len(src))
+	for _, name := range sortedKeys(src) {
+		target := name
+		if _, exists := dst[name]; exists {
+			switch strategy {
+			case "skip":
+				logger.Warnf("install", "Keeping existing %s %s", kind, name)
+				names[name] = name
+				continue
+			case "rename":
+				for i := 2; ; i++ {
+					target = fmt.Sprintf("%s-%d", name, i)
+					if _, taken := dst[target]; !taken {
+						break
+					}
+				}
+				logger.Infof("install", "Adding %s %s as %s", kind, name, target)
+			}
+		}
+		dst[target] = src[name]
+		names[name] = target
+	}
+	return names
+}
+
+// mergedName returns the name an entry was merged under, or name if it was not merged
+func mergedName(names map[string]string, name string) string {
+	if merged, ok := names[name]; ok {
+		return merged
+	}
+	return name
+}
+
+// installKubeconfig merges newConfig into the user's default kubeconfig after
+// backing up the original file, leaving its current-context alone unless switchContext is set
+func installKubeconfig(ctx context.Context, newConfig *api.Config, strategy string, switchContext bool) error {
+	path := installKubeconfigPath()
+	if path == "" {
+		return fmt.Errorf("unable to determine default kubeconfig path")
+	}
+
+	existing := api.NewConfig()
+	if data, err := os.ReadFile(path); err == nil {
+		existing, err = clientcmd.Load(data)
+		if err != nil {
+			return fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+		}
+
+		// Back up the original file before modifying it, replacing the previous backup so
+		// tokens of earlier runs do not pile up next to it
+		backupPath := path + ".bak"
+		if err := writeFileAtomic(ctx, backupPath, data, 0600); err != nil {
+			return fmt.Errorf("failed to back up kubeconfig: %w", err)
+		}
+		logger.Infof("install", "Backed up %s to %s", path, backupPath)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read kubeconfig %s: %w", path, err)
+	}
+
+	// An expired token is no reason to keep an existing user
+	if strategy == "skip" {
+		dropExpiredUsers(existing, newConfig)
+	}
+
+	mergeKubeconfig(existing, newConfig, strategy, switchContext)
+
+	return writeKubeconfig(ctx, existing, path)
+}
+
+// dropExpiredUsers removes the users of dst that src is about to add and whose
+// embedded token has expired, so they are replaced rather than kept
+func dropExpiredUsers(dst, src *api.Config) {
+	now := time.Now()
+	for name := range src.AuthInfos {
+		existing := dst.AuthInfos[name]
+		if existing == nil || existing.Token == "" {
+			continue
+		}
+		if expired, expiry, err := kubetoken.Expired(existing.Token, now); err == nil && expired {
+			logger.Infof("install", "Replacing user %s, whose token expired %s", name, expiry.Format(time.RFC3339))
+			delete(dst.AuthInfos, name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// stdinReader buffers standard input for every prompt of a run, so answers typed
+// ahead are not lost to a second buffer
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptLine prints a prompt and returns the trimmed answer, or defaultValue when empty
+func promptLine(in *bufio.Reader, out io.Writer, prompt, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Fprintf(out, "%s [%s]: ", prompt, defaultValue)
+	} else {
+		fmt.Fprintf(out, "%s: ", prompt)
+	}
+
+	answer, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
+
+// promptChoice prints a numbered menu of options and returns the chosen one, which
+// may be given by number or by name
+func promptChoice(in *bufio.Reader, out io.Writer, title string, options []string) (string, error) {
+	fmt.Fprintf(out, "%s:\n", title)
+	for i, option := range options {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, option)
+	}
+
+	for {
+		answer, err := promptLine(in, out, "Select", "")
+		if err != nil {
+			return "", err
+		}
+		if number, err := strconv.Atoi(answer); err == nil && number >= 1 && number <= len(options) {
+			return options[number-1], nil
+		}
+		for _, option := range options {
+			if answer == option {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(out, "Invalid choice %q\n", answer)
+	}
+}
+
+// selectInteractively asks for the namespace, ServiceAccount and output path,
+// listing the namespaces and ServiceAccounts of the current cluster to pick from
+func selectInteractively(ctx context.Context, reader *bufio.Reader, out io.Writer, config Config) (Config, error) {
+
+	clientset, err := newClientset(config)
+	if err != nil {
+		return config, err
+	}
+
+	title := "Namespace"
+	if config.OpenShift {
+		title = "Project"
+	}
+
+	// Listing namespaces is often forbidden, so fall back to asking for the name
+	namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err == nil && len(namespaceList.Items) > 0 {
+		namespaces := make([]string, 0, len(namespaceList.Items))
+		for _, namespace := range namespaceList.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+		config.Namespace, err = promptChoice(reader, out, title+"s", namespaces)
+	} else {
+		config.Namespace, err = promptLine(reader, out, title, config.Namespace)
+	}
+	if err != nil {
+		return config, err
+	}
+
+	serviceAccountList, err := clientset.CoreV1().ServiceAccounts(config.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return config, fmt.Errorf("failed to list ServiceAccounts in %s %s: %w", namespaceTerm(config), config.Namespace, err)
+	}
+	if len(serviceAccountList.Items) == 0 {
+		return config, fmt.Errorf("no ServiceAccounts in %s %s", namespaceTerm(config), config.Namespace)
+	}
+	serviceAccounts := make([]string, 0, len(serviceAccountList.Items))
+	for _, serviceAccount := range serviceAccountList.Items {
+		serviceAccounts = append(serviceAccounts, serviceAccount.Name)
+	}
+	if config.ServiceAccountName, err = promptChoice(reader, out, "ServiceAccounts", serviceAccounts); err != nil {
+		return config, err
+	}
+
+	if config.OutputPath, err = promptLine(reader, out, "Output path", config.OutputPath); err != nil {
+		return config, err
+	}
+	return config, nil
+}
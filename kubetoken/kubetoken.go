@@ -0,0 +1,92 @@
+// Package kubetoken reads the claims of the ServiceAccount tokens embedded in
+// generated kubeconfigs, so programs managing them can tell when to re-mint
+// without decoding JWTs themselves.
+package kubetoken
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ErrNoExpiry is returned by Expiry for tokens without an exp claim, such as legacy
+// secret tokens
+var ErrNoExpiry = errors.New("token has no exp claim")
+
+// Claims decodes the payload of a JWT without verifying its signature
+func Claims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token payload: %w", err)
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse token claims: %w", err)
+	}
+
+	return claims, nil
+}
+
+// Expiry returns the expiry time from a JWT's exp claim
+func Expiry(token string) (time.Time, error) {
+	claims, err := Claims(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, ErrNoExpiry
+	}
+
+	return time.Unix(int64(exp), 0), nil
+}
+
+// Expired reports whether a JWT expired before now, and when it expires. Tokens
+// without an exp claim never expire and are reported with a zero time.
+func Expired(token string, now time.Time) (bool, time.Time, error) {
+	expiry, err := Expiry(token)
+	if errors.Is(err, ErrNoExpiry) {
+		return false, time.Time{}, nil
+	}
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return !expiry.After(now), expiry, nil
+}
+
+// IsTokenExpired reports whether the token of a context's user has expired, and when
+// it expires. contextName defaults to the current context.
+func IsTokenExpired(cfg *api.Config, contextName string) (bool, time.Time, error) {
+	if contextName == "" {
+		contextName = cfg.CurrentContext
+	}
+	kubeContext := cfg.Contexts[contextName]
+	if kubeContext == nil {
+		return false, time.Time{}, fmt.Errorf("context %q not found", contextName)
+	}
+	authInfo := cfg.AuthInfos[kubeContext.AuthInfo]
+	if authInfo == nil {
+		return false, time.Time{}, fmt.Errorf("user %q of context %s not found", kubeContext.AuthInfo, contextName)
+	}
+	if authInfo.Token == "" {
+		return false, time.Time{}, fmt.Errorf("user %s has no embedded token", kubeContext.AuthInfo)
+	}
+
+	expired, expiry, err := Expired(authInfo.Token, time.Now())
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("user %s: %w", kubeContext.AuthInfo, err)
+	}
+	return expired, expiry, nil
+}
@@ -0,0 +1,52 @@
+package kubetoken
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// jwt builds an unsigned token carrying the given claims payload
+func jwt(payload string) string {
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestIsTokenExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		token   string
+		expired bool
+		expiry  time.Time
+		wantErr bool
+	}{
+		{name: "expired", token: jwt(fmt.Sprintf(`{"exp":%d}`, now.Add(-time.Hour).Unix())), expired: true, expiry: time.Unix(now.Add(-time.Hour).Unix(), 0)},
+		{name: "valid", token: jwt(fmt.Sprintf(`{"exp":%d}`, now.Add(time.Hour).Unix())), expiry: time.Unix(now.Add(time.Hour).Unix(), 0)},
+		{name: "no exp claim", token: jwt(`{"sub":"legacy"}`)},
+		{name: "opaque token", token: "opaque", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := api.NewConfig()
+			cfg.AuthInfos["app"] = &api.AuthInfo{Token: tt.token}
+			cfg.Contexts["app-context"] = &api.Context{Cluster: "cluster", AuthInfo: "app"}
+			cfg.CurrentContext = "app-context"
+
+			expired, expiry, err := IsTokenExpired(cfg, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if expired != tt.expired || !expiry.Equal(tt.expiry) {
+				t.Errorf("got expired %v at %s, want %v at %s", expired, expiry, tt.expired, tt.expiry)
+			}
+		})
+	}
+
+	if _, _, err := IsTokenExpired(api.NewConfig(), "missing"); err == nil {
+		t.Error("expected an error for a missing context")
+	}
+}
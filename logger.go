@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// logger routes informational, warning and fatal messages in the selected -log-format
+var logger = &structuredLogger{format: "text", out: os.Stdout}
+
+// structuredLogger writes plain text messages by default, or logfmt/JSON records
+// carrying step, sa and namespace fields for log aggregators
+type structuredLogger struct {
+	format   string
+	out      io.Writer
+	slog     *slog.Logger
+	warnings []string
+	strict   bool
+	failed   *strictError
+}
+
+// strictError is a warning promoted to an error by -strict
+type strictError struct {
+	code    int
+	message string
+}
+
+func (e *strictError) Error() string {
+	return e.message
+}
+
+// strictExitCodes are the exit codes of warnings promoted to errors by -strict, by
+// step, so pipelines can tell an insecure CA from a legacy token; any other step
+// exits with strictExitCode
+var strictExitCodes = map[string]int{
+	"ca":        10,
+	"token":     11,
+	"server":    12,
+	"namespace": 13,
+	"write":     14,
+}
+
+// strictExitCode is the exit code of promoted warnings without a dedicated code
+const strictExitCode = 19
+
+// newLogger creates a logger for the given format (text, logfmt or json)
+func newLogger(out io.Writer, format string, config Config) (*structuredLogger, error) {
+	l := &structuredLogger{format: format, out: out, strict: config.Strict}
+
+	switch format {
+	case "text":
+		return l, nil
+	case "logfmt":
+		l.slog = slog.New(slog.NewTextHandler(out, nil))
+	case "json":
+		l.slog = slog.New(slog.NewJSONHandler(out, nil))
+	default:
+		return nil, fmt.Errorf("unsupported log format %q, expected text, logfmt or json", format)
+	}
+
+	l.slog = l.slog.With("sa", config.ServiceAccountName, "namespace", config.Namespace)
+	return l, nil
+}
+
+// Infof logs an informational message for the given step
+func (l *structuredLogger) Infof(step, format string, args ...interface{}) {
+	if l.slog == nil {
+		fmt.Fprintf(l.out, format+"\n", args...)
+		return
+	}
+	l.slog.Info(fmt.Sprintf(format, args...), "step", step)
+}
+
+// Warnf logs a warning message for the given step and records it for the -json
+// summary. With -strict the warning is logged as an error and the first one is
+// kept for StrictError, so the caller fails through its normal error path.
+func (l *structuredLogger) Warnf(step, format string, args ...interface{}) {
+	if l.strict {
+		code, ok := strictExitCodes[step]
+		if !ok {
+			code = strictExitCode
+		}
+		if l.slog == nil {
+			log.Printf("Error (strict): "+format, args...)
+		} else {
+			l.slog.Error(fmt.Sprintf(format, args...), "step", step, "strict", true)
+		}
+		if l.failed == nil {
+			l.failed = &strictError{code: code, message: fmt.Sprintf(format, args...)}
+		}
+		return
+	}
+
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+	if l.slog == nil {
+		fmt.Fprintf(l.out, "Warning: "+format+"\n", args...)
+		return
+	}
+	l.slog.Warn(fmt.Sprintf(format, args...), "step", step)
+}
+
+// StrictError returns the first warning promoted by -strict since the last call, if
+// any, and clears it
+func (l *structuredLogger) StrictError() error {
+	if l.failed == nil {
+		return nil
+	}
+	err := l.failed
+	l.failed = nil
+	return err
+}
+
+// Warnings returns the warning messages logged so far
+func (l *structuredLogger) Warnings() []string {
+	return l.warnings
+}
+
+// Fatalf logs an error message for the given step and exits
+func (l *structuredLogger) Fatalf(step, format string, args ...interface{}) {
+	if l.slog == nil {
+		log.Fatalf(format, args...)
+	}
+	l.slog.Error(fmt.Sprintf(format, args...), "step", step)
+	os.Exit(1)
+}
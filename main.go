@@ -2,19 +2,37 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/util/homedir"
+
+	"kubeconfig-generator/kubetoken"
 )
 
 // Config holds the configuration for the kubeconfig generator
@@ -27,40 +45,760 @@ type Config struct {
 	APIServer          string
 	KubeconfigPath     string
 	TokenExpiryHours   int
+	Namespaces         []string
+	PrintTokenClaims   bool
+	PreviewPath        string
+	SetCurrentContext  bool
+	HubSecret          string
+	HubSecretKey       string
+	LogFormat          string
+	Install            bool
+	RecordVersion      bool
+	RotateSecret       string
+	RotateSecretKey    string
+	Headers            []string
+	NoToken            bool
+	Audiences          []string
+	PerAudienceTokens  bool
+	FromMountedToken   bool
+	Timeout            time.Duration
+	APIServerService   string
+	ContextPrefix      string
+	ClusterPrefix      string
+	CertSecret         string
+	NoFallbackToSecret bool
+	SplitOutputDir     string
+	GrantVerbs         []string
+	GrantResources     []string
+	CacheTokens        bool
+	ServerSource       string
+	OutputOwner        string
+	CanonicalUser      bool
+	Watch              bool
+	EnvOutput          string
+	EnvIncludeToken    bool
+	JSONOutput         bool
+	OpenShift          bool
+	MetricsFile        string
+	FromClusterInfo    bool
+	UseSystemTrust     bool
+	MaxConcurrent      int
+	TokenRetries       int
+	TokenRetryDelay    time.Duration
+	PreserveMode       bool
+	ExecCommand        string
+	ExecArgs           []string
+	ExecEnv            []string
+	ExecAPIVersion     string
+	ExpectedIssuer     string
+	Redact             bool
+	TokenMethod        string
+	Compress           bool
+	ProbeServer        bool
+	Template           string
+	Store              string
+	Switch             bool
+	CAPrefer           string
+	ReportOnly         bool
+	MinKubectlVersion  string
+	MergeStrategy      string
+	MaxSourceAge       time.Duration
+	EmitRBAC           string
+	FailOnInsecure     bool
+	SchemaCompat       string
+	ServerDryRun       bool
+	ServerHost         string
+	ServerPort         string
+	Interactive        bool
+	IncludeAuth        []string
+	NamespaceSelector  string
+	NamespacesAllow    []string
+	NamespacesDeny     []string
+	ExecSelfPath       string
+	EmitEvents         bool
+	TokenReview        bool
+	ContextOnly        bool
+	ContextUser        string
+	ResolveHostname    string
+	ContentType        string
+	TokenRequestSpec   string
+	ListAudiences      bool
+	DefaultNamespace   string
+	Checksum           bool
+	Strict             bool
+	TokenSource        string
+	TokenURL           string
+	TokenSubjectFile   string
+	OutputDirCheck     string
+	AuthProvider       string
+	Kubeconfigs        []string
+	SkipIfUnchanged    bool
+	ClientCert         string
+	ClientKey          string
+	InClusterServer    bool
+	ShardBy            string
+	ShardSize          int
+	Policies           []string
+	ServiceAccountUID  string
+}
+
+// operations are the subcommands accepted as the first argument
+var operations = map[string]func(ctx context.Context, args []string) error{
+	"compare":    runCompare,
+	"contexts":   runContexts,
+	"credential": runCredential,
+	"describe":   runDescribe,
+	"doctor":     runDoctor,
+	"drift":      runDrift,
+	"prune":      runPrune,
 }
 
 func main() {
+	// Exit with the code of a warning promoted by -strict once the other deferred cleanups have run
+	defer exitOnStrictError(nil)
+
+	// Cancel in-flight API calls on SIGINT/SIGTERM so nothing is left half-done
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Read the arguments from a file when the first one is @FILE
+	args, err := expandArgsFile(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run an operation instead of generating when one is named
+	if len(args) > 0 {
+		if operation, ok := operations[args[0]]; ok {
+			if err := operation(ctx, args[1:]); err != nil {
+				logger.Fatalf(args[0], "Error: %v", err)
+			}
+			return
+		}
+	}
+
 	var config Config
+	var namespaces string
+	var headers stringList
+	var audiences stringList
+	var grantVerbs, grantResources string
+	var namespacesAllow, namespacesDeny string
+	var kubeconfigs string
+	var execArgs, execEnv stringList
+	var includeAuth stringList
+	var policies stringList
 
 	// Define command-line flags
-	flag.StringVar(&config.ServiceAccountName, "sa", "", "Name of the ServiceAccount (required)")
+	flag.StringVar(&config.ServiceAccountName, "sa", "", "Name of the ServiceAccount (required); - reads names from stdin, one per line")
 	flag.StringVar(&config.Namespace, "namespace", "default", "Namespace of the ServiceAccount")
 	flag.StringVar(&config.OutputPath, "output", "sa-kubeconfig", "Output path for the kubeconfig file")
 	flag.StringVar(&config.ContextName, "context", "", "Context name to use in kubeconfig (defaults to <sa-name>-context)")
 	flag.StringVar(&config.ClusterName, "cluster", "", "Cluster name to use in kubeconfig (defaults from current context)")
 	flag.StringVar(&config.APIServer, "api-server", "", "API server URL (defaults from current context)")
 	flag.StringVar(&config.KubeconfigPath, "kubeconfig", defaultKubeconfigPath(), "Path to the kubeconfig file")
-	flag.IntVar(&config.TokenExpiryHours, "expiry", 8760, "Token expiry in hours (default 1 year)")
+	flag.IntVar(&config.TokenExpiryHours, "expiry", 8760, "Token expiry in hours, at least 1 (default 1 year)")
+	flag.StringVar(&namespaces, "namespaces", "", "Comma-separated namespaces to create one context each for (shares a single cluster and user)")
+	flag.BoolVar(&config.PrintTokenClaims, "print-token-claims", false, "Decode and print the token's JWT claims to stderr")
+	flag.StringVar(&config.PreviewPath, "preview-to", "", "Write the generated kubeconfig to this path instead of -output, leaving -output untouched")
+	flag.BoolVar(&config.SetCurrentContext, "set-current", true, "Set the generated context as the kubeconfig's current-context")
+	flag.StringVar(&config.HubSecret, "hub-secret", "", "Secret (namespace/name) in the hub cluster holding the spoke cluster's kubeconfig")
+	flag.StringVar(&config.HubSecretKey, "hub-secret-key", "kubeconfig", "Data key of the spoke kubeconfig within -hub-secret")
+	flag.StringVar(&config.LogFormat, "log-format", "text", "Log output format: text, logfmt or json")
+	flag.BoolVar(&config.Install, "install", false, "Merge the generated context into the default kubeconfig (KUBECONFIG or ~/.kube/config) instead of -output")
+	flag.BoolVar(&config.RecordVersion, "record-version", false, "Record the API server version in a cluster extension of the generated kubeconfig")
+	flag.StringVar(&config.RotateSecret, "rotate-secret", "", "Secret (namespace/name) holding a generated kubeconfig whose token should be replaced in place")
+	flag.StringVar(&config.RotateSecretKey, "rotate-secret-key", "kubeconfig", "Data key of the kubeconfig within -rotate-secret")
+	flag.Var(&headers, "header", "Extra HTTP header (key=value) to send to the API server (repeatable)")
+	flag.BoolVar(&config.NoToken, "no-token", false, "Skip token retrieval and emit a cluster-only kubeconfig with an empty user")
+	flag.Var(&audiences, "audience", "Audience of the requested token (repeatable)")
+	flag.BoolVar(&config.PerAudienceTokens, "per-audience-tokens", false, "Also mint a separate token per -audience into users named <sa>-<audience>")
+	flag.BoolVar(&config.FromMountedToken, "from-mounted-token", false, "Build the kubeconfig offline from the pod's mounted ServiceAccount token, namespace and CA")
+	flag.DurationVar(&config.Timeout, "timeout", 0, "Abort if generation takes longer than this duration (0 means no timeout)")
+	flag.StringVar(&config.APIServerService, "api-server-from-service", "", "LoadBalancer Service (namespace/name) whose ingress address is used as the API server URL")
+	flag.StringVar(&config.ContextPrefix, "context-prefix", "", "Prefix prepended to generated context names (e.g. prod/)")
+	flag.StringVar(&config.ClusterPrefix, "cluster-prefix", "", "Prefix prepended to the generated cluster name (e.g. prod/)")
+	flag.StringVar(&config.CertSecret, "cert-secret", "", "TLS Secret (namespace/name) whose tls.crt and tls.key are embedded as client certificate instead of a token")
+	flag.BoolVar(&config.NoFallbackToSecret, "no-fallback-to-secret", false, "Fail instead of falling back to a legacy secret token when the token request fails")
+	flag.StringVar(&config.SplitOutputDir, "split-output", "", "Directory to write kubeconfig, token, ca.crt and server.txt into instead of -output")
+	flag.StringVar(&grantVerbs, "grant-verbs", "", "Comma-separated verbs of a Role to create and bind to the ServiceAccount (requires -grant-resources)")
+	flag.StringVar(&grantResources, "grant-resources", "", "Comma-separated resources (resource or resource.group) of the Role created with -grant-verbs")
+	flag.BoolVar(&config.CacheTokens, "cache-tokens", false, "Reuse tokens minted for the same ServiceAccount, audiences and expiry within this run")
+	flag.StringVar(&config.ServerSource, "server-source", "auto", "Where the API server URL comes from: auto, flag (-api-server), context (selected context's server) or in-cluster")
+	flag.StringVar(&config.OutputOwner, "output-owner", "", "Owner (user[:group], names or IDs) to set on the written kubeconfig; requires root")
+	flag.BoolVar(&config.CanonicalUser, "canonical-user", false, "Name the user entry system:serviceaccount:<namespace>:<sa> instead of <sa>")
+	flag.BoolVar(&config.Watch, "watch", false, "Keep running and regenerate the output when the source kubeconfig changes or the token nears expiry, retrying failures with backoff")
+	flag.StringVar(&config.EnvOutput, "env-output", "", "Also write a sourceable file exporting KUBECONFIG to this path")
+	flag.BoolVar(&config.EnvIncludeToken, "env-include-token", false, "Also export KUBE_TOKEN in the -env-output file")
+	flag.BoolVar(&config.JSONOutput, "json", false, "Print a JSON summary (output, context, insecure, warnings) to stdout; log messages go to stderr")
+	flag.BoolVar(&config.OpenShift, "openshift", false, "Use oc instead of kubectl and follow OpenShift's ServiceAccount token secret conventions")
+	flag.StringVar(&config.MetricsFile, "metrics-file", "", "Write Prometheus metrics (tokens minted, failures, fallbacks, latency) to this file")
+	flag.BoolVar(&config.FromClusterInfo, "from-cluster-info", false, "Take the server and CA from the kube-public/cluster-info ConfigMap instead of the current context")
+	flag.BoolVar(&config.UseSystemTrust, "use-system-trust", false, "Omit the CA and insecure-skip-tls-verify so clients rely on the OS trust store (for publicly trusted API servers)")
+	flag.IntVar(&config.MaxConcurrent, "max-concurrent-requests", 0, "Maximum number of concurrent in-flight API requests from this process (0 means unlimited)")
+	flag.IntVar(&config.TokenRetries, "token-retries", 0, "Number of times to retry a token request that fails with a retryable server error")
+	flag.DurationVar(&config.TokenRetryDelay, "token-retry-delay", 2*time.Second, "Delay between token request retries")
+	flag.BoolVar(&config.PreserveMode, "preserve-mode", false, "Keep the mode and owner of an existing output file instead of resetting it to 0600")
+	flag.StringVar(&config.ExecCommand, "exec-command", "", "Emit an exec credential plugin running this command instead of a token")
+	flag.Var(&execArgs, "exec-arg", "Argument passed to the -exec-command plugin (repeatable)")
+	flag.Var(&execEnv, "exec-env", "Environment variable (NAME=VALUE) set for the -exec-command plugin (repeatable)")
+	flag.StringVar(&config.ExecAPIVersion, "exec-api-version", "client.authentication.k8s.io/v1", "ExecCredential API version of the -exec-command plugin")
+	flag.StringVar(&config.ExpectedIssuer, "expected-issuer", "", "Fail unless the minted token's iss claim matches this issuer")
+	flag.BoolVar(&config.Redact, "redact", false, "Mask anything resembling a JWT or bearer token in log and error output")
+	flag.StringVar(&config.TokenMethod, "token-method", "auto", "How the token is obtained: auto (kubectl, then legacy secret), tokenrequest, kubectl or secret")
+	flag.BoolVar(&config.Compress, "compress", false, "Store the kubeconfig in -rotate-secret gzip-compressed under <key>.gz")
+	flag.BoolVar(&config.ProbeServer, "probe-server", false, "Verify the resolved server answers /version or /.well-known/openid-configuration like a Kubernetes API server")
+	flag.StringVar(&config.Template, "template", "", "Go text/template file to render instead of the kubeconfig (fields: Server, CertificateAuthority, InsecureSkipTLSVerify, Token, Namespace, Context, Cluster, User)")
+	flag.StringVar(&config.Store, "store", "file", "Where the token is kept: file (embedded in the kubeconfig) or keyring (OS keyring, read back by an exec hook)")
+	flag.BoolVar(&config.Switch, "switch", false, "With -install, also switch the default kubeconfig's current-context to the generated context")
+	flag.StringVar(&config.CAPrefer, "ca-prefer", "data", "Which CA source of the current cluster to try first: data (certificate-authority-data) or file (certificate-authority)")
+	flag.BoolVar(&config.ReportOnly, "report-only", false, "List every ServiceAccount in -namespace (or -namespaces) and whether a token could be minted for it, without minting or writing anything")
+	flag.StringVar(&config.MinKubectlVersion, "require-kubectl-version", "", "Fail the kubectl token path when the kubectl (or oc) client is older than this version (e.g. 1.24)")
+	flag.StringVar(&config.MergeStrategy, "merge-strategy", "overwrite", "How -install resolves name collisions: skip (keep existing), overwrite (replace) or rename (add with a numeric suffix)")
+	flag.DurationVar(&config.MaxSourceAge, "max-source-age", 0, "Refuse a source kubeconfig last modified longer ago than this duration (0 means no limit)")
+	flag.StringVar(&config.EmitRBAC, "emit-rbac", "", "Also write the RoleBindings and ClusterRoleBindings of the ServiceAccount, with their roles, as a YAML manifest to this path")
+	flag.BoolVar(&config.FailOnInsecure, "fail-on-insecure", false, "Fail instead of generating a kubeconfig with insecure-skip-tls-verify")
+	flag.StringVar(&config.SchemaCompat, "schema-compat", "", "Rewrite the written kubeconfig for legacy consumers: legacy drops fields old parsers reject (see README)")
+	flag.BoolVar(&config.ServerDryRun, "server-dry-run", false, "Send created and updated resources with server-side dry-run to check admission, without minting a token or writing the kubeconfig")
+	flag.StringVar(&config.ServerHost, "server-host", "", "Replace the host of the resolved API server URL, keeping its scheme and port")
+	flag.StringVar(&config.ServerPort, "server-port", "", "Replace the port of the resolved API server URL, keeping its scheme and host")
+	flag.BoolVar(&config.Interactive, "interactive", false, "Pick the namespace and ServiceAccount from menus of the current cluster and prompt for the output path")
+	flag.Var(&includeAuth, "include-auth", "Extra user entry without a context: name=token[:sa] or name=cert:namespace/secret (repeatable)")
+	flag.StringVar(&config.NamespaceSelector, "namespace-selector", "", "With -report-only, cover the namespaces matching this label selector instead of -namespace or -namespaces")
+	flag.StringVar(&namespacesAllow, "namespaces-allow", "", "Comma-separated namespace glob patterns (e.g. team-*) generation and -report-only are limited to")
+	flag.StringVar(&namespacesDeny, "namespaces-deny", "", "Comma-separated namespace glob patterns generation and -report-only never touch (wins over -namespaces-allow)")
+	flag.StringVar(&config.ExecSelfPath, "exec-self-path", "", "Command written into exec hooks that run this tool (with -store), instead of the absolute path of the running binary")
+	flag.BoolVar(&config.EmitEvents, "emit-events", false, "Record generation warnings (insecure fallback, legacy token, ...) as Warning Events on the ServiceAccount")
+	flag.BoolVar(&config.TokenReview, "token-review", false, "Verify the minted token with the TokenReview API and print the username and groups it authenticates as")
+	flag.BoolVar(&config.ContextOnly, "context-only", false, "Only write the -context entry tying the existing -cluster and -user to -namespace into -output (or the default kubeconfig with -install)")
+	flag.StringVar(&config.ContextUser, "user", "", "Existing user the -context-only context refers to")
+	flag.StringVar(&config.ResolveHostname, "resolve-hostname", "", "Look up the PTR record of an IP server address and use it as the server host (server) or as tls-server-name (tls-server-name)")
+	flag.StringVar(&config.ContentType, "content-type", "", "Record a recommended REST content type (json or protobuf) as a context extension for downstream tooling")
+	flag.StringVar(&config.TokenRequestSpec, "token-request-spec", "", "Path to a TokenRequest YAML manifest sent with -token-method=tokenrequest; -audience and -expiry override its fields when given")
+	flag.BoolVar(&config.ListAudiences, "list-audiences", false, "Mint a short-lived token for the ServiceAccount and print the API server's default audiences, without writing anything")
+	flag.StringVar(&config.DefaultNamespace, "default-namespace", "", "Default namespace of the generated context when it differs from the ServiceAccount's -namespace, e.g. one it is granted access to by a RoleBinding")
+	flag.BoolVar(&config.Checksum, "checksum", false, "Also write <output>.sha256 with the SHA-256 of the written kubeconfig, verifiable with sha256sum -c")
+	flag.BoolVar(&config.Strict, "strict", false, "Treat every warning as an error, exiting with a code for its kind (10 CA, 11 token, 12 server, 13 namespace, 14 write, 19 other)")
+	flag.StringVar(&config.TokenSource, "token-source", "serviceaccount", "Where the token comes from: serviceaccount (minted through the cluster) or webhook (exchanged at -token-url)")
+	flag.StringVar(&config.TokenURL, "token-url", "", "Endpoint POSTed to for a token with -token-source=webhook")
+	flag.StringVar(&config.TokenSubjectFile, "token-subject-file", "", "File with the token to exchange, sent as a bearer token to -token-url")
+	flag.StringVar(&config.OutputDirCheck, "output-dir-check", "warn", "What to do when the output directory is world-readable or world-writable: warn, error or off")
+	flag.StringVar(&config.AuthProvider, "auth-provider", "", "Emit a legacy auth-provider plugin instead of a token, as name=NAME,key=value,...")
+	flag.StringVar(&kubeconfigs, "kubeconfigs", "", "Comma-separated admin kubeconfigs to mint the ServiceAccount's token in, one context (<context>-<cluster>) per file's current cluster, combined into one output")
+	flag.BoolVar(&config.SkipIfUnchanged, "skip-if-unchanged", false, "Leave the output file untouched when only its tokens would change and they are still valid")
+	flag.StringVar(&config.ClientCert, "client-cert", "", "Client certificate file to authenticate to the API server with for minting, instead of the kubeconfig user's credentials")
+	flag.StringVar(&config.ClientKey, "client-key", "", "Private key file of -client-cert")
+	flag.BoolVar(&config.InClusterServer, "in-cluster-server", false, "Generate for workloads in the same cluster: use https://kubernetes.default.svc as the server and the cluster's root CA from the kube-root-ca.crt ConfigMap")
+	flag.StringVar(&config.ShardBy, "shard-by", "", "Split the output into one file per cluster (cluster), written to <output>-<cluster>")
+	flag.IntVar(&config.ShardSize, "shard-size", 0, "Split the output into files of at most this many contexts, written to <output>-<n> (per cluster with -shard-by)")
+	flag.Var(&policies, "policy", "Reject the kubeconfig before it is written unless it satisfies this policy: no-insecure, max-expiry=DURATION or require-namespace=NAMESPACE (repeatable)")
+	flag.StringVar(&config.ServiceAccountUID, "sa-uid", "", "Expected metadata.uid of the ServiceAccount; refuse to mint for a recreated ServiceAccount of the same name (does not fill the boundObjectRef of -token-request-spec, which names a Pod, Secret or Node)")
+
+	// Describe the flags just defined for tools writing JSON arguments files
+	if len(args) > 0 && args[0] == "schema" {
+		if err := runSchema(flag.CommandLine, args[1:]); err != nil {
+			logger.Fatalf("schema", "Error: %v", err)
+		}
+		return
+	}
+
+	flag.CommandLine.Parse(args)
 
-	flag.Parse()
+	config.Namespaces = splitList(namespaces)
+	config.Headers = headers
+	config.Audiences = audiences
+	config.GrantVerbs = splitList(grantVerbs)
+	config.GrantResources = splitList(grantResources)
+	config.ExecArgs = execArgs
+	config.ExecEnv = execEnv
+	config.IncludeAuth = includeAuth
+	config.NamespacesAllow = splitList(namespacesAllow)
+	config.NamespacesDeny = splitList(namespacesDeny)
+	config.Kubeconfigs = splitList(kubeconfigs)
+	config.Policies = policies
+
+	// Set up logging in the requested format, keeping stdout for the JSON summary with -json
+	logOutput := io.Writer(os.Stdout)
+	if config.JSONOutput {
+		logOutput = os.Stderr
+	}
+	if config.Redact {
+		logOutput = redactingWriter{out: logOutput}
+		log.SetOutput(redactingWriter{out: os.Stderr})
+	}
+	configuredLogger, err := newLogger(logOutput, config.LogFormat, config)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger = configuredLogger
+
+	// Use the pod's own identity when building from the mounted token
+	if config.FromMountedToken {
+		if config, err = applyMountedIdentity(config); err != nil {
+			logger.Fatalf("mounted-token", "Error reading mounted ServiceAccount: %v", err)
+		}
+	}
+
+	// Pick the namespace, ServiceAccount and output path from menus
+	if config.Interactive {
+		if config.ServiceAccountName == "-" || config.FromMountedToken || config.ReportOnly {
+			logger.Fatalf("validate", "Error: -interactive cannot be combined with -sa -, -from-mounted-token or -report-only")
+		}
+		if config, err = selectInteractively(ctx, stdinReader, os.Stderr, config); err != nil {
+			logger.Fatalf("interactive", "Error: %v", err)
+		}
+	}
 
 	// Validate required flags
-	if config.ServiceAccountName == "" {
-		log.Fatal("Error: ServiceAccount name is required")
+	if config.ServiceAccountName == "" && !config.ReportOnly && !config.ContextOnly {
+		logger.Fatalf("validate", "Error: ServiceAccount name is required")
+	}
+
+	if config.ExecCommand != "" && (config.NoToken || config.CertSecret != "" || len(config.Audiences) > 0) {
+		logger.Fatalf("validate", "Error: -exec-command cannot be combined with -no-token, -cert-secret or -audience")
+	}
+
+	if config.CertSecret != "" && (config.NoToken || len(config.Audiences) > 0) {
+		logger.Fatalf("validate", "Error: -cert-secret cannot be combined with -no-token or -audience")
+	}
+
+	if (len(config.GrantVerbs) == 0) != (len(config.GrantResources) == 0) {
+		logger.Fatalf("validate", "Error: -grant-verbs and -grant-resources must be used together")
+	}
+
+	switch config.ServerSource {
+	case "auto", "flag", "context", "in-cluster":
+	default:
+		logger.Fatalf("validate", "Error: invalid -server-source %q, expected auto, flag, context or in-cluster", config.ServerSource)
+	}
+
+	if config.CAPrefer != "data" && config.CAPrefer != "file" {
+		logger.Fatalf("validate", "Error: invalid -ca-prefer %q, expected data or file", config.CAPrefer)
+	}
+
+	switch config.TokenMethod {
+	case "auto", "tokenrequest", "kubectl":
+	case "secret":
+		if len(config.Audiences) > 0 {
+			logger.Fatalf("validate", "Error: -token-method=secret cannot be combined with -audience, legacy secret tokens are not bound to audiences")
+		}
+	default:
+		logger.Fatalf("validate", "Error: invalid -token-method %q, expected auto, tokenrequest, kubectl or secret", config.TokenMethod)
+	}
+
+	if config.TokenRequestSpec != "" {
+		if config.TokenMethod != "tokenrequest" {
+			logger.Fatalf("validate", "Error: -token-request-spec requires -token-method=tokenrequest")
+		}
+		request, err := loadTokenRequestSpec(config.TokenRequestSpec)
+		if err != nil {
+			logger.Fatalf("validate", "Error: %v", err)
+		}
+
+		// Take the spec's expiry unless -expiry was given, keeping refresh and caching in step with it
+		expirySet := false
+		flag.Visit(func(f *flag.Flag) { expirySet = expirySet || f.Name == "expiry" })
+		if seconds := request.Spec.ExpirationSeconds; seconds != nil && !expirySet {
+			if *seconds <= 0 || *seconds%3600 != 0 {
+				logger.Fatalf("validate", "Error: expirationSeconds %d in -token-request-spec is not a whole number of hours, set -expiry instead", *seconds)
+			}
+			config.TokenExpiryHours = int(*seconds / 3600)
+		}
+	}
+
+	// The TokenRequest API rejects lifetimes under 10 minutes, so -expiry 0 cannot mean "no expiry"
+	if config.TokenExpiryHours < 1 {
+		logger.Fatalf("validate", "Error: -expiry must be at least 1 hour, got %d", config.TokenExpiryHours)
+	}
+
+	if config.Watch && (config.HubSecret != "" || config.RotateSecret != "" || config.Install) {
+		logger.Fatalf("validate", "Error: -watch cannot be combined with -hub-secret, -rotate-secret or -install")
+	}
+
+	if config.Template != "" && (config.Install || config.SplitOutputDir != "") {
+		logger.Fatalf("validate", "Error: -template cannot be combined with -install or -split-output")
+	}
+
+	if config.SchemaCompat != "" {
+		if config.SchemaCompat != "legacy" {
+			logger.Fatalf("validate", "Error: invalid -schema-compat %q, expected legacy", config.SchemaCompat)
+		}
+		if config.Install || config.SplitOutputDir != "" || config.Template != "" {
+			logger.Fatalf("validate", "Error: -schema-compat cannot be combined with -install, -split-output or -template")
+		}
+	}
+
+	if config.Store != "file" {
+		if _, err := newCredentialStore(config.Store); err != nil {
+			logger.Fatalf("validate", "Error: invalid -store: %v", err)
+		}
+		if config.EnvIncludeToken || config.SplitOutputDir != "" || config.Template != "" || config.FromMountedToken {
+			logger.Fatalf("validate", "Error: -store %s cannot be combined with -env-include-token, -split-output, -template or -from-mounted-token", config.Store)
+		}
+	}
+
+	if config.ServiceAccountName == "-" && (config.RotateSecret != "" || config.Watch || config.HubSecret != "" ||
+		config.PreviewPath != "" || config.SplitOutputDir != "" || config.EnvOutput != "" || config.JSONOutput || config.ReportOnly ||
+		config.EmitRBAC != "") {
+		logger.Fatalf("validate", "Error: -sa - cannot be combined with -rotate-secret, -watch, -hub-secret, -preview-to, -split-output, -env-output, -json, -report-only or -emit-rbac")
+	}
+
+	if config.ServerDryRun && (config.Watch || config.FromMountedToken || config.Store != "file") {
+		logger.Fatalf("validate", "Error: -server-dry-run cannot be combined with -watch, -from-mounted-token or -store")
+	}
+
+	for _, pattern := range append(config.NamespacesAllow, config.NamespacesDeny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			logger.Fatalf("validate", "Error: invalid namespace pattern %q: %v", pattern, err)
+		}
+	}
+
+	if config.ListAudiences && (config.ServiceAccountName == "-" || config.FromMountedToken || config.ReportOnly || config.ContextOnly) {
+		logger.Fatalf("validate", "Error: -list-audiences cannot be combined with -sa -, -from-mounted-token, -report-only or -context-only")
+	}
+
+	if _, err := newTokenSource(config.TokenSource, nil); err != nil {
+		logger.Fatalf("validate", "Error: invalid -token-source: %v", err)
+	}
+	if config.TokenSource == "webhook" {
+		if config.TokenURL == "" {
+			logger.Fatalf("validate", "Error: -token-source=webhook requires -token-url")
+		}
+		if config.NoToken || config.CertSecret != "" || config.ExecCommand != "" || config.FromMountedToken ||
+			config.PerAudienceTokens || len(config.GrantVerbs) > 0 || config.TokenRequestSpec != "" {
+			logger.Fatalf("validate", "Error: -token-source=webhook cannot be combined with -no-token, -cert-secret, -exec-command, -from-mounted-token, -per-audience-tokens, -grant-verbs or -token-request-spec")
+		}
+		if strings.HasPrefix(config.TokenURL, "http://") {
+			logger.Warnf("token", "-token-url %s is not HTTPS, the exchanged tokens travel in plain text", config.TokenURL)
+		}
+	} else if config.TokenURL != "" || config.TokenSubjectFile != "" {
+		logger.Fatalf("validate", "Error: -token-url and -token-subject-file require -token-source=webhook")
+	}
+
+	if len(config.Kubeconfigs) > 0 && (config.ServiceAccountName == "-" || config.FromMountedToken || config.ContextOnly ||
+		config.ReportOnly || config.ListAudiences || config.RotateSecret != "" || config.HubSecret != "" || config.Watch ||
+		config.APIServer != "" || config.ClusterName != "" || config.EmitRBAC != "" || config.EmitEvents ||
+		config.SplitOutputDir != "" || config.Template != "") {
+		logger.Fatalf("validate", "Error: -kubeconfigs cannot be combined with -sa -, -from-mounted-token, -context-only, -report-only, -list-audiences, -rotate-secret, -hub-secret, -watch, -api-server, -cluster, -emit-rbac, -emit-events, -split-output or -template")
+	}
+
+	if config.AuthProvider != "" {
+		if _, err := parseAuthProvider(config.AuthProvider); err != nil {
+			logger.Fatalf("validate", "Error: invalid -auth-provider: %v", err)
+		}
+		if config.NoToken || config.CertSecret != "" || config.ExecCommand != "" || config.TokenSource != "serviceaccount" ||
+			config.FromMountedToken || len(config.Audiences) > 0 || config.Store != "file" {
+			logger.Fatalf("validate", "Error: -auth-provider cannot be combined with -no-token, -cert-secret, -exec-command, -token-source, -from-mounted-token, -audience or -store")
+		}
 	}
 
-	// Set default context name if not provided
-	if config.ContextName == "" {
-		config.ContextName = fmt.Sprintf("%s-context", config.ServiceAccountName)
+	switch config.OutputDirCheck {
+	case "warn", "error", "off":
+	default:
+		logger.Fatalf("validate", "Error: invalid -output-dir-check %q, expected warn, error or off", config.OutputDirCheck)
+	}
+
+	if (config.ClientCert == "") != (config.ClientKey == "") {
+		logger.Fatalf("validate", "Error: -client-cert and -client-key must be given together")
+	}
+	if config.ClientCert != "" {
+		if _, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey); err != nil {
+			logger.Fatalf("validate", "Error: invalid -client-cert/-client-key: %v", err)
+		}
+	}
+
+	if config.InClusterServer {
+		if config.APIServer != "" || (config.ServerSource != "auto" && config.ServerSource != "in-cluster") || config.FromClusterInfo ||
+			config.UseSystemTrust || config.FromMountedToken || len(config.Kubeconfigs) > 0 {
+			logger.Fatalf("validate", "Error: -in-cluster-server cannot be combined with -api-server, -server-source, -from-cluster-info, -use-system-trust, -from-mounted-token or -kubeconfigs")
+		}
+		config.ServerSource = "in-cluster"
+	}
+
+	if config.ServiceAccountUID != "" && (config.TokenSource != "serviceaccount" || config.ExecCommand != "" ||
+		config.CertSecret != "" || config.AuthProvider != "" || config.ServiceAccountName == "-" || len(config.Kubeconfigs) > 0) {
+		logger.Fatalf("validate", "Error: -sa-uid cannot be combined with -token-source, -exec-command, -cert-secret, -auth-provider, -sa - or -kubeconfigs")
+	}
+
+	for _, spec := range config.Policies {
+		if _, err := parsePolicy(spec); err != nil {
+			logger.Fatalf("validate", "Error: invalid -policy: %v", err)
+		}
+	}
+
+	if config.ShardBy != "" && config.ShardBy != "cluster" {
+		logger.Fatalf("validate", "Error: invalid -shard-by %q, expected cluster", config.ShardBy)
+	}
+	if config.ShardSize < 0 {
+		logger.Fatalf("validate", "Error: -shard-size must not be negative")
+	}
+	if (config.ShardBy != "" || config.ShardSize > 0) && (config.Install || config.SplitOutputDir != "" || config.Template != "" ||
+		config.SchemaCompat != "" || config.SkipIfUnchanged || config.Checksum || config.PreserveMode || config.OutputOwner != "") {
+		logger.Fatalf("validate", "Error: -shard-by and -shard-size cannot be combined with -install, -split-output, -template, -schema-compat, -skip-if-unchanged, -checksum, -preserve-mode or -output-owner")
+	}
+
+	if config.SkipIfUnchanged && (config.Install || config.SplitOutputDir != "" || config.Template != "" || config.SchemaCompat != "") {
+		logger.Fatalf("validate", "Error: -skip-if-unchanged cannot be combined with -install, -split-output, -template or -schema-compat")
+	}
+
+	if config.Checksum && (config.Install || config.SplitOutputDir != "") {
+		logger.Fatalf("validate", "Error: -checksum cannot be combined with -install or -split-output")
+	}
+
+	if config.DefaultNamespace != "" && (len(config.Namespaces) > 0 || config.ContextOnly) {
+		logger.Fatalf("validate", "Error: -default-namespace cannot be combined with -namespaces or -context-only")
+	}
+
+	if config.NamespaceSelector != "" && !config.ReportOnly {
+		logger.Fatalf("validate", "Error: -namespace-selector requires -report-only")
+	}
+
+	// Keep generation within the allowed namespaces
+	if !config.ReportOnly {
+		for _, namespace := range append([]string{config.Namespace, config.DefaultNamespace}, config.Namespaces...) {
+			if namespace == "" {
+				continue
+			}
+			if !namespaceAllowed(config, namespace) {
+				logger.Fatalf("validate", "Error: %s %s is excluded by -namespaces-allow/-namespaces-deny", namespaceTerm(config), namespace)
+			}
+		}
+	}
+
+	if len(config.IncludeAuth) > 0 {
+		if _, err := parseIncludeAuth(config.IncludeAuth, config); err != nil {
+			logger.Fatalf("validate", "Error: %v", err)
+		}
+		if config.FromMountedToken {
+			logger.Fatalf("validate", "Error: -include-auth cannot be combined with -from-mounted-token")
+		}
+	}
+
+	switch config.ResolveHostname {
+	case "", "server", "tls-server-name":
+	default:
+		logger.Fatalf("validate", "Error: invalid -resolve-hostname %q, expected server or tls-server-name", config.ResolveHostname)
+	}
+	if config.ResolveHostname != "" && config.FromMountedToken {
+		logger.Fatalf("validate", "Error: -resolve-hostname cannot be combined with -from-mounted-token")
+	}
+	if _, ok := contentTypes[config.ContentType]; config.ContentType != "" && !ok {
+		logger.Fatalf("validate", "Error: invalid -content-type %q, expected json or protobuf", config.ContentType)
+	}
+
+	if config.ContextOnly {
+		if config.ContextName == "" || config.ClusterName == "" || config.ContextUser == "" {
+			logger.Fatalf("validate", "Error: -context-only requires -context, -cluster and -user")
+		}
+		if config.ServiceAccountName != "" || config.RotateSecret != "" || config.ReportOnly || config.Watch {
+			logger.Fatalf("validate", "Error: -context-only cannot be combined with -sa, -rotate-secret, -report-only or -watch")
+		}
+	} else if config.ContextUser != "" {
+		logger.Fatalf("validate", "Error: -user requires -context-only")
+	}
+
+	if config.EmitEvents && (config.FromMountedToken || config.ServiceAccountName == "-") {
+		logger.Fatalf("validate", "Error: -emit-events cannot be combined with -from-mounted-token or -sa -")
+	}
+
+	if config.EmitRBAC != "" && config.FromMountedToken {
+		logger.Fatalf("validate", "Error: -emit-rbac cannot be combined with -from-mounted-token")
+	}
+
+	switch config.MergeStrategy {
+	case "skip", "overwrite", "rename":
+	default:
+		logger.Fatalf("validate", "Error: invalid -merge-strategy %q, expected skip, overwrite or rename", config.MergeStrategy)
+	}
+
+	if config.Switch && !config.Install {
+		logger.Fatalf("validate", "Error: -switch requires -install")
+	}
+
+	if config.ExecSelfPath != "" && config.Store == "file" {
+		logger.Fatalf("validate", "Error: -exec-self-path requires -store")
+	}
+
+	if config.Compress && config.RotateSecret == "" {
+		logger.Fatalf("validate", "Error: -compress requires -rotate-secret")
+	}
+
+	if config.PerAudienceTokens && len(config.Audiences) == 0 {
+		logger.Fatalf("validate", "Error: -per-audience-tokens requires at least one -audience")
+	}
+
+	// Set default context name if not provided (per name when reading names from stdin)
+	if config.ServiceAccountName != "-" {
+		if config.ContextName == "" {
+			config.ContextName = fmt.Sprintf("%s-context", config.ServiceAccountName)
+		}
+		config.ContextName = config.ContextPrefix + config.ContextName
+	}
+
+	// Bound the whole operation when a timeout is set
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	// Generate one kubeconfig per ServiceAccount name read from stdin
+	if config.ServiceAccountName == "-" {
+		if err := generateForNames(ctx, os.Stdin, config); err != nil {
+			logger.Fatalf("generate", "Error: %v", err)
+		}
+		return
+	}
+
+	// Only report which ServiceAccounts tokens could be minted for
+	if config.ReportOnly {
+		if err := reportMintable(ctx, os.Stdout, config); err != nil {
+			logger.Fatalf("report", "Error: %v", err)
+		}
+		return
+	}
+
+	if config.ListAudiences {
+		if err := listAudiences(ctx, os.Stdout, config); err != nil {
+			logger.Fatalf("audiences", "Error: %v", err)
+		}
+		return
+	}
+
+	// Only add or update the context in an existing kubeconfig
+	if config.ContextOnly {
+		path, err := writeContextOnly(ctx, config)
+		if err != nil {
+			logger.Fatalf("write", "Error writing context: %v", err)
+		}
+		logger.Infof("write", "Context %s written to %s", config.ContextName, path)
+		return
+	}
+
+	// Rotate the token in a kubeconfig stored in a Secret instead of generating a new file
+	if config.RotateSecret != "" {
+		if err := rotateSecretToken(ctx, config); err != nil {
+			logger.Fatalf("rotate", "Error rotating token in secret: %v", err)
+		}
+		if config.ServerDryRun {
+			logger.Infof("rotate", "Update of secret %s passes admission (server dry-run)", config.RotateSecret)
+			return
+		}
+		logger.Infof("rotate", "Token rotated in secret: %s", config.RotateSecret)
+		return
+	}
+
+	// Connect to the spoke cluster using the kubeconfig stored in the hub
+	cleanup := func() {}
+	if config.HubSecret != "" {
+		spokePath, removeSpoke, err := fetchSpokeKubeconfig(ctx, config)
+		if err != nil {
+			logger.Fatalf("hub", "Error loading spoke kubeconfig: %v", err)
+		}
+		cleanup = removeSpoke
+		config.KubeconfigPath = spokePath
 	}
 
 	// Generate kubeconfig
-	if err := generateKubeconfig(config); err != nil {
-		log.Fatalf("Error generating kubeconfig: %v", err)
+	generator := NewGenerator(config)
+	start := time.Now()
+	err = generator.Generate(ctx)
+	if config.EmitEvents {
+		// Record warnings on the ServiceAccount for cluster operators
+		if eventErr := emitWarningEvents(ctx, config, logger.Warnings()); eventErr != nil {
+			logger.Warnf("events", "Failed to record warnings as Events: %v", eventErr)
+		}
 	}
+	cleanup()
+	recordGeneration(config, time.Since(start), err)
+	if err != nil {
+		exitOnStrictError(err)
+		logger.Fatalf("generate", "Error generating kubeconfig: %v", err)
+	}
+
+	reportOutput(config, generator.Kubeconfig)
 
-	fmt.Printf("Kubeconfig file created at: %s\n", config.OutputPath)
-	fmt.Printf("Use with: export KUBECONFIG=%s\n", config.OutputPath)
+	if config.JSONOutput {
+		if err := writeSummary(os.Stdout, config, generator.Kubeconfig, logger.Warnings()); err != nil {
+			logger.Fatalf("summary", "Error writing JSON summary: %v", err)
+		}
+	}
+
+	// Keep the output in sync with the source kubeconfig until interrupted
+	if config.Watch {
+		if err := watchAndRegenerate(ctx, config); err != nil {
+			logger.Fatalf("watch", "Error watching kubeconfig: %v", err)
+		}
+	}
+}
+
+// exitOnStrictError exits with the step's code when err, or a warning recorded since
+// the last check, was promoted to an error by -strict. It is only called from main,
+// so deferred cleanups elsewhere always run first.
+func exitOnStrictError(err error) {
+	if err == nil {
+		err = logger.StrictError()
+	}
+	var strictErr *strictError
+	if errors.As(err, &strictErr) {
+		os.Exit(strictErr.code)
+	}
+}
+
+// recordGeneration records the outcome of a generation and updates the -metrics-file
+func recordGeneration(config Config, duration time.Duration, err error) {
+	metrics.observeGeneration(duration, err)
+	if config.MetricsFile != "" {
+		if err := metrics.writeFile(config.MetricsFile); err != nil {
+			logger.Warnf("metrics", "%v", err)
+		}
+	}
+}
+
+// reportOutput tells the user where the generated kubeconfig went and how to use it
+func reportOutput(config Config, newConfig *api.Config) {
+	if config.ServerDryRun {
+		logger.Infof("write", "Server dry-run: no token minted and no kubeconfig written")
+		return
+	}
+
+	if config.Install {
+		logger.Infof("install", "Context %s installed into %s", generatedContextName(config, newConfig), installKubeconfigPath())
+		if config.Switch {
+			logger.Infof("install", "Switched current context to %s", generatedContextName(config, newConfig))
+		} else {
+			logger.Infof("install", "Use with: kubectl config use-context %s", generatedContextName(config, newConfig))
+		}
+		return
+	}
+
+	if config.SplitOutputDir != "" {
+		logger.Infof("write", "Kubeconfig, token, ca.crt and server.txt created in: %s", config.SplitOutputDir)
+		logger.Infof("write", "Use with: export KUBECONFIG=%s", filepath.Join(config.SplitOutputDir, "kubeconfig"))
+		return
+	}
+
+	// The shards and the KUBECONFIG value joining them were reported as they were written
+	if config.ShardBy != "" || config.ShardSize > 0 {
+		return
+	}
+
+	if config.PreviewPath != "" {
+		logger.Infof("write", "Preview kubeconfig created at: %s (%s left untouched)", config.PreviewPath, config.OutputPath)
+		return
+	}
+
+	// A rendered template is not a kubeconfig, so there is nothing to point kubectl at
+	if config.Template != "" {
+		logger.Infof("write", "Rendered %s to: %s", config.Template, config.OutputPath)
+		return
+	}
+
+	logger.Infof("write", "Kubeconfig file created at: %s", config.OutputPath)
+	logger.Infof("write", "Use with: export KUBECONFIG=%s", config.OutputPath)
+	logger.Infof("write", "Or: kubectl config use-context %s --kubeconfig %s", generatedContextName(config, newConfig), config.OutputPath)
+	if config.EnvOutput != "" {
+		logger.Infof("write", "Or: source %s", config.EnvOutput)
+	}
 }
 
 func defaultKubeconfigPath() string {
@@ -70,136 +808,754 @@ func defaultKubeconfigPath() string {
 	return ""
 }
 
-func generateKubeconfig(config Config) error {
-	// Load the kubeconfig file
-	currentConfig, err := clientcmd.LoadFromFile(config.KubeconfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to load kubeconfig: %w", err)
+// inClusterServer is the API server address as seen from inside the cluster
+const inClusterServer = "https://kubernetes.default.svc"
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	// Create Kubernetes clientset
+// newClientset creates a Kubernetes clientset from the configured kubeconfig file
+func newClientset(config Config) (*kubernetes.Clientset, error) {
 	clientConfig, err := clientcmd.BuildConfigFromFlags("", config.KubeconfigPath)
 	if err != nil {
-		return fmt.Errorf("failed to build config from flags: %w", err)
+		return nil, fmt.Errorf("failed to build config from flags: %w", err)
+	}
+
+	useClientCertificate(clientConfig, config)
+	if err := configureClient(clientConfig, config); err != nil {
+		return nil, err
 	}
 
 	clientset, err := kubernetes.NewForConfig(clientConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create clientset: %w", err)
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	return clientset, nil
+}
+
+// generateKubeconfig assembles a kubeconfig for the ServiceAccount from the source kubeconfig's cluster.
+// The returned function revokes a -grant-verbs grant; the caller runs it when a later step fails.
+func generateKubeconfig(ctx context.Context, config Config) (*api.Config, func(), error) {
+	// Refuse a stale source kubeconfig, whose CA may have been rotated since
+	if config.MaxSourceAge > 0 {
+		if err := checkSourceAge(config.KubeconfigPath, config.MaxSourceAge); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Load the kubeconfig file
+	currentConfig, err := clientcmd.LoadFromFile(config.KubeconfigPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	// Create Kubernetes clientset
+	clientset, err := newClientset(config)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Get current context and cluster info
 	currentContext := currentConfig.Contexts[currentConfig.CurrentContext]
 	if currentContext == nil {
-		return fmt.Errorf("no current context found")
+		return nil, nil, fmt.Errorf("no current context found")
 	}
 
 	currentCluster := currentConfig.Clusters[currentContext.Cluster]
 	if currentCluster == nil {
-		return fmt.Errorf("no cluster found for current context")
+		return nil, nil, fmt.Errorf("no cluster found for current context")
+	}
+
+	// Resolve the cluster name, server and CA source, once per batch
+	cluster, err := cachedCluster(ctx, clientset, config, currentContext, currentCluster)
+	if err != nil {
+		return nil, nil, err
 	}
+	config.ClusterName = cluster.name
+	config.APIServer = cluster.server
+	tlsServerName := cluster.tlsServerName
+	currentCluster = cluster.source
+
+	// Verify the namespace exists, ignoring errors such as missing permission to read namespaces
+	_, err = clientset.CoreV1().Namespaces().Get(ctx, config.Namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("%s %s does not exist", namespaceTerm(config), config.Namespace)
+	}
+
+	// Read the client certificate instead of minting a token for cert-based identities,
+	// which need not be ServiceAccounts
+	var clientCert, clientKey []byte
+	var execCredential *api.ExecConfig
+	var authProvider *api.AuthProviderConfig
+	if config.CertSecret != "" {
+		clientCert, clientKey, err = clientCertFromSecret(ctx, clientset, config.CertSecret)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if config.ExecCommand != "" {
+		// The exec plugin supplies the identity, so no ServiceAccount is involved
+		if execCredential, err = execConfig(config); err != nil {
+			return nil, nil, err
+		}
+	} else if config.AuthProvider != "" {
+		// The auth-provider plugin supplies the identity, as with exec plugins
+		if authProvider, err = parseAuthProvider(config.AuthProvider); err != nil {
+			return nil, nil, err
+		}
+	} else if config.TokenSource != "webhook" {
+		// Verify the ServiceAccount exists; exchanged tokens need not belong to one in this cluster
+		sa, err := clientset.CoreV1().ServiceAccounts(config.Namespace).Get(
+			ctx,
+			config.ServiceAccountName,
+			metav1.GetOptions{},
+		)
+		if apierrors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("ServiceAccount %s does not exist in %s %s",
+				config.ServiceAccountName, namespaceTerm(config), config.Namespace)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get ServiceAccount %s in %s %s: %w",
+				config.ServiceAccountName, namespaceTerm(config), config.Namespace, err)
+		}
+		// Catch a ServiceAccount deleted and recreated under the same name
+		if config.ServiceAccountUID != "" && string(sa.UID) != config.ServiceAccountUID {
+			return nil, nil, fmt.Errorf("ServiceAccount %s in %s %s has UID %s, expected %s",
+				config.ServiceAccountName, namespaceTerm(config), config.Namespace, sa.UID, config.ServiceAccountUID)
+		}
+	}
+
+	// Create and bind a least-privilege Role when requested
+	revokeGrant := func() {}
+	if len(config.GrantVerbs) > 0 {
+		if revokeGrant, err = grantAccess(ctx, clientset, config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Get service account token, unless a cluster-only, certificate or exec kubeconfig was
+	// requested or nothing is to be persisted with -server-dry-run
+	var token string
+	if !config.NoToken && config.CertSecret == "" && config.ExecCommand == "" && config.AuthProvider == "" && !config.ServerDryRun {
+		source, err := newTokenSource(config.TokenSource, clientset)
+		if err != nil {
+			revokeGrant()
+			return nil, nil, err
+		}
+		token, err = source.Token(ctx, config)
+		if err != nil {
+			revokeGrant()
+			return nil, nil, fmt.Errorf("failed to get token: %w", err)
+		}
+
+		if config.PrintTokenClaims {
+			printTokenClaims(os.Stderr, token)
+		}
+
+		// Confirm the cluster accepts the token and show whom it authenticates as
+		if config.TokenReview {
+			user, err := reviewToken(ctx, clientset, token, config.Audiences)
+			if err != nil {
+				revokeGrant()
+				return nil, nil, err
+			}
+			logger.Infof("token-review", "Token authenticates as %s (groups: %s)", user.Username, strings.Join(user.Groups, ", "))
+		}
+	}
+
+	// Create a new kubeconfig
+	newConfig := api.NewConfig()
+
+	// Add cluster
+	newConfig.Clusters[config.ClusterName] = api.NewCluster()
+	newConfig.Clusters[config.ClusterName].Server = config.APIServer
+	newConfig.Clusters[config.ClusterName].TLSServerName = tlsServerName
+
+	// Add CA certificate data if available
+	if err := applyCertificateAuthority(newConfig.Clusters[config.ClusterName], currentCluster, config); err != nil {
+		revokeGrant()
+		return nil, nil, err
+	}
+
+	// Make sure the resolved server really serves a Kubernetes API before baking it in
+	if config.ProbeServer {
+		if err := probeServer(ctx, newConfig.Clusters[config.ClusterName], config); err != nil {
+			revokeGrant()
+			return nil, nil, err
+		}
+	}
+
+	// Record the server version the kubeconfig was generated against
+	if config.RecordVersion {
+		if extension, err := serverVersionExtension(clientset); err == nil {
+			newConfig.Clusters[config.ClusterName].Extensions[serverVersionExtensionName] = extension
+		} else {
+			logger.Warnf("version", "Failed to record server version: %v", err)
+		}
+	}
+
+	// Add user with token, client certificate, exec or auth-provider plugin (left empty with -no-token for the consumer to fill in)
+	newConfig.AuthInfos[authInfoName(config)] = &api.AuthInfo{
+		Token:                 token,
+		ClientCertificateData: clientCert,
+		ClientKeyData:         clientKey,
+		Exec:                  execCredential,
+		AuthProvider:          authProvider,
+	}
+
+	// Mint a separate token per audience, each in its own user entry
+	if config.PerAudienceTokens && !config.NoToken && !config.ServerDryRun {
+		for _, audience := range config.Audiences {
+			audienceConfig := config
+			audienceConfig.Audiences = []string{audience}
+			audienceToken, err := getServiceAccountToken(ctx, clientset, audienceConfig)
+			if err != nil {
+				revokeGrant()
+				return nil, nil, fmt.Errorf("failed to get token for audience %s: %w", audience, err)
+			}
+			newConfig.AuthInfos[fmt.Sprintf("%s-%s", authInfoName(config), audience)] = &api.AuthInfo{
+				Token: audienceToken,
+			}
+		}
+	}
+
+	// Add the extra credentials of a -include-auth catalog
+	if len(config.IncludeAuth) > 0 && !config.ServerDryRun {
+		if err := addIncludedAuthInfos(ctx, clientset, config, newConfig); err != nil {
+			revokeGrant()
+			return nil, nil, err
+		}
+	}
+
+	addContexts(newConfig, config)
+
+	// Catch a default namespace the ServiceAccount has not been granted anything in
+	if token != "" && config.DefaultNamespace != "" && config.DefaultNamespace != config.Namespace {
+		if allowed, err := hasNamespaceAccess(ctx, config, token, config.DefaultNamespace); err != nil {
+			logger.Warnf("namespace", "Could not check access in default namespace %s: %v", config.DefaultNamespace, err)
+		} else if !allowed {
+			logger.Warnf("namespace", "ServiceAccount %s/%s appears to have no access in default namespace %s, check its RoleBindings there",
+				config.Namespace, config.ServiceAccountName, config.DefaultNamespace)
+		}
+	}
+
+	return newConfig, revokeGrant, nil
+}
+
+// resolveCluster works out the name, server and CA source of the generated cluster
+// entry from the source kubeconfig's current cluster and the server flags
+func resolveCluster(ctx context.Context, clientset *kubernetes.Clientset, config Config, currentContext *api.Context, currentCluster *api.Cluster) (resolvedCluster, error) {
+	var err error
 
 	// Set default cluster name if not provided
 	if config.ClusterName == "" {
 		config.ClusterName = currentContext.Cluster
 	}
+	config.ClusterName = config.ClusterPrefix + config.ClusterName
+
+	// Use the server and CA published for bootstrapping nodes when requested
+	if config.FromClusterInfo {
+		if currentCluster, err = clusterInfoFromConfigMap(ctx, clientset); err != nil {
+			return resolvedCluster{}, err
+		}
+	}
+
+	// Trust the CA that signs kubernetes.default.svc rather than the external endpoint's
+	if config.InClusterServer {
+		if currentCluster, err = inClusterCertificateAuthority(ctx, clientset, config.Namespace, currentCluster); err != nil {
+			return resolvedCluster{}, err
+		}
+	}
+
+	// Pick the API server explicitly when -server-source is not auto
+	switch config.ServerSource {
+	case "flag":
+		if config.APIServer == "" {
+			return resolvedCluster{}, fmt.Errorf("-server-source=flag requires -api-server")
+		}
+	case "context":
+		config.APIServer = currentCluster.Server
+	case "in-cluster":
+		config.APIServer = inClusterServer
+	}
+
+	// Read the API server from a LoadBalancer Service's ingress when requested
+	if config.APIServer == "" && config.APIServerService != "" {
+		config.APIServer, err = apiServerFromService(ctx, clientset, config.APIServerService)
+		if err != nil {
+			return resolvedCluster{}, err
+		}
+		if config.APIServer == "" {
+			logger.Warnf("server", "Service %s has no load balancer ingress yet, using the current context's server", config.APIServerService)
+		}
+	}
 
 	// Set default API server if not provided
 	if config.APIServer == "" {
 		config.APIServer = currentCluster.Server
 	}
 
-	// Verify the ServiceAccount exists
-	_, err = clientset.CoreV1().ServiceAccounts(config.Namespace).Get(
-		context.TODO(),
-		config.ServiceAccountName,
-		metav1.GetOptions{},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to get ServiceAccount %s in namespace %s: %w",
-			config.ServiceAccountName, config.Namespace, err)
+	// Swap in an externally reachable host or port
+	if config.ServerHost != "" || config.ServerPort != "" {
+		if config.APIServer, err = overrideServerAddress(config.APIServer, config.ServerHost, config.ServerPort); err != nil {
+			return resolvedCluster{}, err
+		}
+	}
+
+	// Use the hostname of a server IP, for certificates issued for hostnames
+	var tlsServerName string
+	if config.ResolveHostname != "" {
+		if config.APIServer, tlsServerName, err = resolveServerHostname(ctx, config.APIServer, config.ResolveHostname); err != nil {
+			return resolvedCluster{}, err
+		}
 	}
 
-	// Get service account token
-	token, err := getServiceAccountToken(clientset, config)
+	return resolvedCluster{
+		name:          config.ClusterName,
+		server:        config.APIServer,
+		tlsServerName: tlsServerName,
+		source:        currentCluster,
+	}, nil
+}
+
+// checkSourceAge fails when the kubeconfig at path was last modified longer than maxAge ago
+func checkSourceAge(path string, maxAge time.Duration) error {
+	info, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("failed to get token: %w", err)
+		return fmt.Errorf("failed to check kubeconfig age: %w", err)
+	}
+	if age := time.Since(info.ModTime()); age > maxAge {
+		return fmt.Errorf("kubeconfig %s was last modified %s ago, more than -max-source-age %s",
+			path, age.Round(time.Second), maxAge)
 	}
+	return nil
+}
 
-	// Create a new kubeconfig
-	newConfig := api.NewConfig()
+// applyCertificateAuthority copies the source cluster's CA, picked according to -ca-prefer,
+// into cluster, falling back to insecure-skip-tls-verify when no valid one is available,
+// or failing with -fail-on-insecure. With -use-system-trust neither is set and the OS
+// trust store is used.
+func applyCertificateAuthority(cluster, source *api.Cluster, config Config) error {
+	if config.UseSystemTrust {
+		return nil
+	}
 
-	// Add cluster
-	newConfig.Clusters[config.ClusterName] = &api.Cluster{
-		Server: config.APIServer,
+	caData, cached, err := cachedCertificateAuthority(source, config.CAPrefer)
+	if err != nil {
+		if config.FailOnInsecure {
+			return fmt.Errorf("%w, refusing to generate an insecure kubeconfig with -fail-on-insecure", err)
+		}
+		if !cached {
+			logger.Warnf("ca", "%v. Setting insecure-skip-tls-verify: true", err)
+		}
+		cluster.InsecureSkipTLSVerify = true
+		return nil
 	}
+	cluster.CertificateAuthorityData = caData
+	return nil
+}
 
-	// Add CA certificate data if available
-	if len(currentCluster.CertificateAuthorityData) > 0 {
-		newConfig.Clusters[config.ClusterName].CertificateAuthorityData = currentCluster.CertificateAuthorityData
-	} else if currentCluster.CertificateAuthority != "" {
-		caData, err := os.ReadFile(currentCluster.CertificateAuthority)
-		if err == nil {
-			newConfig.Clusters[config.ClusterName].CertificateAuthorityData = caData
-		} else {
-			fmt.Printf("Warning: Failed to read CA certificate: %v\n", err)
-			fmt.Println("Setting insecure-skip-tls-verify: true")
-			newConfig.Clusters[config.ClusterName].InsecureSkipTLSVerify = true
+// addContexts adds the generated context, or one context per namespace when
+// -namespaces is set, and sets the current context
+func addContexts(newConfig *api.Config, config Config) {
+	// Add context, or one context per namespace when -namespaces is set
+	if len(config.Namespaces) == 0 {
+		newConfig.Contexts[config.ContextName] = &api.Context{
+			Cluster:   config.ClusterName,
+			AuthInfo:  authInfoName(config),
+			Namespace: contextNamespace(config),
 		}
 	} else {
-		fmt.Println("Warning: No CA certificate data found. Setting insecure-skip-tls-verify: true")
-		newConfig.Clusters[config.ClusterName].InsecureSkipTLSVerify = true
+		for _, ns := range config.Namespaces {
+			newConfig.Contexts[fmt.Sprintf("%s-%s", config.ContextName, ns)] = &api.Context{
+				Cluster:   config.ClusterName,
+				AuthInfo:  authInfoName(config),
+				Namespace: ns,
+			}
+		}
 	}
 
-	// Add user with token
-	newConfig.AuthInfos[config.ServiceAccountName] = &api.AuthInfo{
-		Token: token,
+	// Set current context
+	if config.SetCurrentContext {
+		newConfig.CurrentContext = primaryContextName(config)
 	}
+}
 
-	// Add context
-	newConfig.Contexts[config.ContextName] = &api.Context{
-		Cluster:   config.ClusterName,
-		AuthInfo:  config.ServiceAccountName,
-		Namespace: config.Namespace,
+// authInfoName returns the name of the generated user entry, which is the
+// ServiceAccount's full username with -canonical-user
+func authInfoName(config Config) string {
+	if config.CanonicalUser {
+		return fmt.Sprintf("system:serviceaccount:%s:%s", config.Namespace, config.ServiceAccountName)
 	}
+	return config.ServiceAccountName
+}
 
-	// Set current context
-	newConfig.CurrentContext = config.ContextName
+// primaryContextName returns the name of the main generated context, which is the
+// first namespace's context when -namespaces is set
+func primaryContextName(config Config) string {
+	if len(config.Namespaces) > 0 {
+		return fmt.Sprintf("%s-%s", config.ContextName, config.Namespaces[0])
+	}
+	return config.ContextName
+}
+
+// generatedContextName returns the main context of the generated kubeconfig: its
+// current context, which is the first file's with -kubeconfigs, or else
+// primaryContextName when -set-current=false left it unset
+func generatedContextName(config Config, newConfig *api.Config) string {
+	if newConfig != nil && newConfig.CurrentContext != "" {
+		return newConfig.CurrentContext
+	}
+	return primaryContextName(config)
+}
+
+// outputKubeconfig writes the generated kubeconfig to its destination
+func outputKubeconfig(ctx context.Context, config Config, newConfig *api.Config) error {
+	// Merge into the default kubeconfig instead of writing a standalone file
+	if config.Install {
+		return installKubeconfig(ctx, newConfig, config.MergeStrategy, config.Switch)
+	}
+
+	// Write the kubeconfig and its individual components into a directory
+	if config.SplitOutputDir != "" {
+		return writeSplitOutput(ctx, config, newConfig)
+	}
+
+	// Write to the preview path instead of the output path when requested
+	outputPath := config.OutputPath
+	if config.PreviewPath != "" {
+		outputPath = config.PreviewPath
+	}
+
+	// Keep each file small when the kubeconfig spans many clusters or contexts
+	if config.ShardBy != "" || config.ShardSize > 0 {
+		return writeShardedOutput(ctx, config, newConfig, outputPath)
+	}
+
+	// Avoid touching the file, and its mtime, when only fresh tokens would be written
+	if config.SkipIfUnchanged {
+		unchanged, err := kubeconfigUnchanged(outputPath, newConfig)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			logger.Infof("write", "%s is unchanged, leaving it untouched", outputPath)
+			return nil
+		}
+	}
+
+	// Remember the existing file's mode and owner so they survive the overwrite
+	var preserved *preservedAttributes
+	if config.PreserveMode {
+		var err error
+		if preserved, err = capturePreservedAttributes(outputPath); err != nil {
+			return err
+		}
+	}
+
+	// Render a custom format instead of serializing the kubeconfig
+	if config.Template != "" {
+		if err := writeTemplateOutput(ctx, config, newConfig, outputPath); err != nil {
+			return err
+		}
+	} else if config.SchemaCompat != "" {
+		if err := writeCompatKubeconfig(ctx, config, newConfig, outputPath); err != nil {
+			return err
+		}
+	} else if err := writeKubeconfig(ctx, newConfig, outputPath); err != nil {
+		return err
+	}
+
+	if preserved != nil {
+		if err := preserved.restore(outputPath); err != nil {
+			return err
+		}
+	}
+
+	// Named pipes cannot be read back, and their content is gone once consumed
+	if config.Checksum {
+		if info, err := os.Stat(outputPath); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+			logger.Warnf("checksum", "Not writing a checksum for named pipe %s", outputPath)
+		} else if err := writeChecksum(outputPath); err != nil {
+			return err
+		}
+	}
+
+	// Hand the file over to its intended owner
+	if config.OutputOwner != "" {
+		return chownOutput(outputPath, config.OutputOwner)
+	}
+	return nil
+}
+
+// serverVersionExtensionName is the cluster extension holding the recorded server version
+const serverVersionExtensionName = "kubeconfig-generator/server-version"
+
+// serverVersionExtension queries the API server version and wraps it as a kubeconfig extension
+func serverVersionExtension(clientset *kubernetes.Clientset) (runtime.Object, error) {
+	info, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover server version: %w", err)
+	}
+
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode server version: %w", err)
+	}
+
+	return &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}, nil
+}
+
+// writeKubeconfig writes the kubeconfig to path, creating parent directories and restricting permissions
+func writeKubeconfig(ctx context.Context, newConfig *api.Config, path string) error {
+	// Don't start writing once the operation has been cancelled
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not writing kubeconfig: %w", err)
+	}
 
 	// Create output directory if it doesn't exist
-	outputDir := filepath.Dir(config.OutputPath)
+	outputDir := filepath.Dir(path)
 	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(outputDir, 0755); err != nil {
 			return fmt.Errorf("failed to create output directory: %w", err)
 		}
 	}
 
-	// Write the kubeconfig to file
-	if err := clientcmd.WriteToFile(*newConfig, config.OutputPath); err != nil {
-		return fmt.Errorf("failed to write kubeconfig to file: %w", err)
+	// Write the kubeconfig to file with permissions 0600 (rw-------)
+	data, err := clientcmd.Write(*newConfig)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	if err := writeOutputFile(ctx, path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig to %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeOutputFile writes credential-bearing output to path: straight into it when
+// path is a named pipe, and atomically with the given permissions otherwise
+func writeOutputFile(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	// Named pipes are written directly, without creating directories or changing permissions
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		return writeToPipe(ctx, path, data)
+	}
+	return writeFileAtomic(ctx, path, data, perm)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into
+// place, so readers see either the old or the complete new file. The rename is only
+// committed while ctx is live; on cancellation or any failure the temporary file is
+// removed and path is left untouched.
+func writeFileAtomic(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	// Replace the target of a symlinked output rather than the link itself
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
 	}
+	committed := false
+	defer func() {
+		if !committed {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
 
-	// Set file permissions to 0600 (rw-------)
-	if err := os.Chmod(config.OutputPath, 0600); err != nil {
-		return fmt.Errorf("failed to set kubeconfig file permissions: %w", err)
+	if err := file.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
 	}
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("write interrupted: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+	committed = true
 	return nil
 }
 
-// getServiceAccountToken gets a token for the service account using direct API call
-func getServiceAccountToken(clientset *kubernetes.Clientset, config Config) (string, error) {
-	// First, try to use kubectl to create a token (for newer Kubernetes versions)
-	if token, err := createTokenWithKubectl(config); err == nil && token != "" {
+// writeFileMode writes data to path with the given permissions. New files are created
+// with that mode and existing files are switched to it before anything is written, so
+// private content is never readable by others, whatever the umask.
+func writeFileMode(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeToPipe writes data to a named pipe, giving up when the context is done
+// before a reader opens the pipe
+func writeToPipe(ctx context.Context, path string, data []byte) error {
+	// Opening a pipe for writing blocks until a reader opens it
+	done := make(chan error, 1)
+	go func() {
+		pipe, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			done <- err
+			return
+		}
+		_, err = pipe.Write(data)
+		if closeErr := pipe.Close(); err == nil {
+			err = closeErr
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for a reader of the pipe: %w", ctx.Err())
+	}
+}
+
+// getServiceAccountToken gets a token for the service account, reusing a token
+// minted earlier in this run when -cache-tokens is set
+func getServiceAccountToken(ctx context.Context, clientset *kubernetes.Clientset, config Config) (string, error) {
+	if !config.CacheTokens {
+		return mintServiceAccountToken(ctx, clientset, config)
+	}
+
+	// A long-running process (e.g. -watch) may outlive a cached token
+	if token, ok := cachedToken(config); ok {
+		if expired, _, err := kubetoken.Expired(token, time.Now()); err != nil || !expired {
+			return token, nil
+		}
+	}
+
+	token, err := mintServiceAccountToken(ctx, clientset, config)
+	if err != nil {
+		return "", err
+	}
+	cacheToken(config, token)
+	return token, nil
+}
+
+// mintServiceAccountToken gets a token for the service account with the selected -token-method
+func mintServiceAccountToken(ctx context.Context, clientset *kubernetes.Clientset, config Config) (string, error) {
+	// Force the legacy secret token, e.g. on clusters without the TokenRequest API
+	if config.TokenMethod == "secret" {
+		return secretToken(ctx, clientset, config)
+	}
+
+	// First, request a token with kubectl or the TokenRequest API (for newer Kubernetes versions)
+	source, request := cliBinary(config), func() (string, error) {
+		return createTokenWithKubectl(ctx, config)
+	}
+	if config.TokenMethod == "tokenrequest" {
+		source, request = "TokenRequest", func() (string, error) {
+			return createTokenWithTokenRequest(ctx, clientset, config)
+		}
+	}
+	token, err := retryTokenRequest(ctx, config, request)
+	if err == nil && token != "" {
+		if err := validateToken(token); err != nil {
+			return "", fmt.Errorf("%s returned an invalid token: %w", source, err)
+		}
+		if err := checkTokenIssuer(token, config.ExpectedIssuer); err != nil {
+			return "", err
+		}
+		if err := checkTokenServiceAccountUID(token, config.ServiceAccountUID); err != nil {
+			return "", err
+		}
+		metrics.tokenMinted()
 		return token, nil
 	}
 
+	// Surface the token request failure instead of silently using a legacy token,
+	// which is also never used when a method was chosen explicitly
+	if config.NoFallbackToSecret || config.TokenMethod == "kubectl" || config.TokenMethod == "tokenrequest" {
+		if err == nil {
+			err = fmt.Errorf("%s returned an empty token", source)
+		}
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+
+	// Legacy secret tokens are not bound to any audience
+	if len(config.Audiences) > 0 {
+		return "", fmt.Errorf("token request failed and legacy secret tokens cannot be scoped to audiences %s",
+			strings.Join(config.Audiences, ","))
+	}
+
 	// Fall back to getting a token from a secret (for older Kubernetes versions)
-	return getTokenFromSecret(clientset, config)
+	logger.Warnf("token", "Token request failed, using the legacy secret token: %v", err)
+	metrics.fellBackToSecret()
+	return secretToken(ctx, clientset, config)
 }
 
-// createTokenWithKubectl tries to create a token using kubectl command
-func createTokenWithKubectl(config Config) (string, error) {
+// secretToken reads and validates the ServiceAccount's legacy secret token
+func secretToken(ctx context.Context, clientset *kubernetes.Clientset, config Config) (string, error) {
+	token, err := getTokenFromSecret(ctx, clientset, config)
+	if err != nil {
+		return "", err
+	}
+	if err := validateToken(token); err != nil {
+		return "", fmt.Errorf("secret contains an invalid token: %w", err)
+	}
+	if err := checkTokenIssuer(token, config.ExpectedIssuer); err != nil {
+		return "", err
+	}
+	if err := checkTokenServiceAccountUID(token, config.ServiceAccountUID); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// minTokenLength is the shortest token accepted; real ServiceAccount tokens are far longer
+const minTokenLength = 20
+
+// validateToken rejects empty or truncated tokens before they are written into a kubeconfig
+func validateToken(token string) error {
+	if token == "" {
+		return fmt.Errorf("token is empty")
+	}
+	if len(token) < minTokenLength {
+		return fmt.Errorf("token is %d characters long, expected at least %d", len(token), minTokenLength)
+	}
+	return nil
+}
+
+// createTokenWithKubectl tries to create a token using the kubectl (or oc) command
+func createTokenWithKubectl(ctx context.Context, config Config) (string, error) {
+	// Fail clearly instead of with "unknown command" on clients without create token
+	if config.MinKubectlVersion != "" {
+		if err := checkCLIVersion(ctx, config, config.MinKubectlVersion); err != nil {
+			return "", err
+		}
+	}
+
 	// Try using kubectl create token
 	kubeconfigFlag := ""
 	if config.KubeconfigPath != "" {
@@ -211,13 +1567,23 @@ func createTokenWithKubectl(config Config) (string, error) {
 	if kubeconfigFlag != "" {
 		args = append(args, kubeconfigFlag)
 	}
+	if config.ClientCert != "" {
+		args = append(args, "--client-certificate="+config.ClientCert, "--client-key="+config.ClientKey)
+	}
 	args = append(args, fmt.Sprintf("--duration=%dh", config.TokenExpiryHours))
+	for _, audience := range config.Audiences {
+		args = append(args, fmt.Sprintf("--audience=%s", audience))
+	}
 
 	// Execute the command and capture output
-	cmd := exec.Command("kubectl", args...)
+	cmd := exec.CommandContext(ctx, cliBinary(config), args...)
 	out, err := cmd.Output()
 	if err != nil {
 		// This is expected to fail on older Kubernetes versions
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
 		return "", err
 	}
 
@@ -225,10 +1591,10 @@ func createTokenWithKubectl(config Config) (string, error) {
 }
 
 // getTokenFromSecret gets a token from the service account's secret
-func getTokenFromSecret(clientset *kubernetes.Clientset, config Config) (string, error) {
+func getTokenFromSecret(ctx context.Context, clientset kubernetes.Interface, config Config) (string, error) {
 	// Get ServiceAccount to find its secrets
 	sa, err := clientset.CoreV1().ServiceAccounts(config.Namespace).Get(
-		context.TODO(),
+		ctx,
 		config.ServiceAccountName,
 		metav1.GetOptions{},
 	)
@@ -236,15 +1602,20 @@ func getTokenFromSecret(clientset *kubernetes.Clientset, config Config) (string,
 		return "", fmt.Errorf("failed to get ServiceAccount: %w", err)
 	}
 
-	// Check if the ServiceAccount has any secrets
-	if len(sa.Secrets) == 0 {
-		return "", fmt.Errorf("service account has no secrets")
+	// Find the token secret, following OpenShift's naming conventions
+	var secretName string
+	if config.OpenShift && len(sa.Secrets) > 0 {
+		secretName = openShiftTokenSecretName(ctx, clientset, config.Namespace, sa)
+	} else {
+		if secretName, err = tokenSecretName(ctx, clientset, config, sa); err != nil {
+			return "", err
+		}
+	}
+	if secretName == "" {
+		return "", fmt.Errorf("service account has no token secret")
 	}
-
-	// Get the first secret (token secret)
-	secretName := sa.Secrets[0].Name
 	secret, err := clientset.CoreV1().Secrets(config.Namespace).Get(
-		context.TODO(),
+		ctx,
 		secretName,
 		metav1.GetOptions{},
 	)
@@ -258,5 +1629,101 @@ func getTokenFromSecret(clientset *kubernetes.Clientset, config Config) (string,
 		return "", fmt.Errorf("token not found in secret %s", secretName)
 	}
 
-	return string(tokenData), nil
+	return normalizeSecretToken(tokenData, secretName), nil
+}
+
+// tokenSecretName finds the legacy token secret of a ServiceAccount. Clusters before
+// 1.24 list it among the ServiceAccount's secrets, possibly after pull secrets, while
+// token secrets created by hand since then (e.g. for the default ServiceAccount of
+// legacy apps) are only linked to it through their annotation. When several secrets
+// hold a token, the user picks one with -interactive and the newest is used otherwise.
+// Without permission to list secrets, or when none is annotated for the ServiceAccount,
+// the first listed secret is used.
+func tokenSecretName(ctx context.Context, clientset kubernetes.Interface, config Config, sa *corev1.ServiceAccount) (string, error) {
+	secrets, err := clientset.CoreV1().Secrets(sa.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeServiceAccountToken),
+	})
+	var listed string
+	if len(sa.Secrets) > 0 {
+		listed = sa.Secrets[0].Name
+	}
+	if err != nil {
+		return listed, nil
+	}
+
+	var candidates []corev1.Secret
+	for _, secret := range secrets.Items {
+		if secret.Annotations[corev1.ServiceAccountNameKey] != sa.Name {
+			continue
+		}
+		if uid := secret.Annotations[corev1.ServiceAccountUIDKey]; uid != "" && uid != string(sa.UID) {
+			continue
+		}
+		// Skip secrets the token controller has not populated yet
+		if len(secret.Data["token"]) == 0 {
+			continue
+		}
+		candidates = append(candidates, secret)
+	}
+	if len(candidates) == 0 {
+		return listed, nil
+	}
+	if len(candidates) == 1 {
+		return candidates[0].Name, nil
+	}
+
+	// Newest first
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[j].CreationTimestamp.Before(&candidates[i].CreationTimestamp)
+	})
+
+	if config.Interactive {
+		options := make([]string, len(candidates))
+		names := map[string]string{}
+		for i, secret := range candidates {
+			options[i] = fmt.Sprintf("%s (age %s)", secret.Name, duration.HumanDuration(time.Since(secret.CreationTimestamp.Time)))
+			names[options[i]] = secret.Name
+		}
+		choice, err := promptChoice(stdinReader, os.Stderr,
+			fmt.Sprintf("ServiceAccount %s has %d token secrets", sa.Name, len(candidates)), options)
+		if err != nil {
+			return "", err
+		}
+		return names[choice], nil
+	}
+
+	logger.Infof("token", "ServiceAccount %s has %d token secrets, using the newest, %s", sa.Name, len(candidates), candidates[0].Name)
+	return candidates[0].Name, nil
+}
+
+// jwtPattern matches the three base64url-encoded segments of a JWT
+var jwtPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*$`)
+
+// opaqueTokenPattern matches legacy opaque bearer tokens
+var opaqueTokenPattern = regexp.MustCompile(`^[A-Za-z0-9._~+/=-]+$`)
+
+// normalizeSecretToken cleans up token data read from a secret, unwrapping
+// PEM blocks and an extra layer of base64 encoding when present
+func normalizeSecretToken(tokenData []byte, secretName string) string {
+	token := strings.TrimSpace(string(tokenData))
+
+	// Unwrap PEM-wrapped token data
+	if block, _ := pem.Decode([]byte(token)); block != nil {
+		token = strings.TrimSpace(string(block.Bytes))
+	}
+
+	// Decode tokens that were base64-encoded a second time
+	if !jwtPattern.MatchString(token) {
+		if decoded, err := base64.StdEncoding.DecodeString(token); err == nil {
+			if candidate := strings.TrimSpace(string(decoded)); jwtPattern.MatchString(candidate) {
+				token = candidate
+			}
+		}
+	}
+
+	if !jwtPattern.MatchString(token) && !opaqueTokenPattern.MatchString(token) {
+		logger.Warnf("token", "Token in secret %s does not look like a JWT or opaque bearer token", secretName)
+	}
+
+	return token
 }
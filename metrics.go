@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// generationLatencyBuckets are the upper bounds, in seconds, of the generation latency histogram
+var generationLatencyBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60}
+
+// metrics counts operations for the -metrics-file Prometheus text output
+var metrics = &generatorMetrics{bucketCounts: make([]uint64, len(generationLatencyBuckets))}
+
+// generatorMetrics holds the counters and latency histogram of this process
+type generatorMetrics struct {
+	mu               sync.Mutex
+	tokensMinted     uint64
+	fallbackToSecret uint64
+	failures         uint64
+	bucketCounts     []uint64
+	latencyCount     uint64
+	latencySum       float64
+}
+
+// tokenMinted records a successfully minted token
+func (m *generatorMetrics) tokenMinted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokensMinted++
+}
+
+// fellBackToSecret records a fallback to a legacy secret token
+func (m *generatorMetrics) fellBackToSecret() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallbackToSecret++
+}
+
+// observeGeneration records the latency and outcome of one generation
+func (m *generatorMetrics) observeGeneration(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.failures++
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range generationLatencyBuckets {
+		if seconds <= bound {
+			m.bucketCounts[i]++
+		}
+	}
+	m.latencyCount++
+	m.latencySum += seconds
+}
+
+// writeFile writes the metrics in Prometheus text exposition format, e.g. for the
+// node exporter's textfile collector
+func (m *generatorMetrics) writeFile(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	writeCounter := func(name, help string, value uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	writeCounter("kubeconfig_generator_tokens_minted_total", "Tokens minted for ServiceAccounts.", m.tokensMinted)
+	writeCounter("kubeconfig_generator_fallback_to_secret_total", "Token requests that fell back to a legacy secret token.", m.fallbackToSecret)
+	writeCounter("kubeconfig_generator_failures_total", "Kubeconfig generations that failed.", m.failures)
+
+	name := "kubeconfig_generator_generation_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Time taken to generate a kubeconfig.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range generationLatencyBuckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%g\"} %d\n", name, bound, m.bucketCounts[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latencyCount)
+	fmt.Fprintf(&b, "%s_sum %g\n%s_count %d\n", name, m.latencySum, name, m.latencyCount)
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
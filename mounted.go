@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// mountedServiceAccountDir is where Kubernetes projects a pod's ServiceAccount credentials
+const mountedServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// readMountedFile reads a file from the mounted ServiceAccount directory
+func readMountedFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(mountedServiceAccountDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mounted %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// applyMountedIdentity sets the namespace from the mounted namespace file and,
+// when -sa is not given, the ServiceAccount name from the mounted token's claims
+func applyMountedIdentity(config Config) (Config, error) {
+	namespace, err := readMountedFile("namespace")
+	if err != nil {
+		return config, err
+	}
+	config.Namespace = strings.TrimSpace(string(namespace))
+
+	if config.ServiceAccountName == "" {
+		token, err := readMountedFile("token")
+		if err != nil {
+			return config, err
+		}
+		claims, err := kubetoken.Claims(strings.TrimSpace(string(token)))
+		if err != nil {
+			return config, fmt.Errorf("failed to read ServiceAccount name from mounted token: %w", err)
+		}
+		config.ServiceAccountName = serviceAccountNameFromClaims(claims)
+	}
+
+	return config, nil
+}
+
+// serviceAccountNameFromClaims extracts the ServiceAccount name from bound or legacy token claims
+func serviceAccountNameFromClaims(claims map[string]interface{}) string {
+	if k8s, ok := claims["kubernetes.io"].(map[string]interface{}); ok {
+		if sa, ok := k8s["serviceaccount"].(map[string]interface{}); ok {
+			if name, ok := sa["name"].(string); ok {
+				return name
+			}
+		}
+	}
+	if name, ok := claims["kubernetes.io/serviceaccount/service-account.name"].(string); ok {
+		return name
+	}
+	return ""
+}
+
+// generateFromMountedToken builds a kubeconfig from the pod's mounted ServiceAccount
+// token and CA without making any API calls
+func generateFromMountedToken(config Config) (*api.Config, error) {
+	token, err := readMountedFile("token")
+	if err != nil {
+		return nil, err
+	}
+
+	caData, err := readMountedFile("ca.crt")
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the in-cluster API server address unless one was given
+	if config.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set, or use -api-server")
+		}
+		config.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+
+	if config.ServerHost != "" || config.ServerPort != "" {
+		if config.APIServer, err = overrideServerAddress(config.APIServer, config.ServerHost, config.ServerPort); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ClusterName == "" {
+		config.ClusterName = "in-cluster"
+	}
+	config.ClusterName = config.ClusterPrefix + config.ClusterName
+
+	newConfig := api.NewConfig()
+
+	newConfig.Clusters[config.ClusterName] = api.NewCluster()
+	newConfig.Clusters[config.ClusterName].Server = config.APIServer
+	if !config.UseSystemTrust {
+		newConfig.Clusters[config.ClusterName].CertificateAuthorityData = caData
+	}
+
+	newConfig.AuthInfos[authInfoName(config)] = &api.AuthInfo{
+		Token: strings.TrimSpace(string(token)),
+	}
+
+	addContexts(newConfig, config)
+
+	return newConfig, nil
+}
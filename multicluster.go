@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// generateAcrossKubeconfigs mints the ServiceAccount's credentials in the current
+// cluster of each -kubeconfigs file in turn and combines the results into one
+// kubeconfig. Each cluster's entry, context (<context>-<cluster>) and user
+// (<sa>-<cluster>) are named after the cluster with -cluster-prefix, and -context
+// is the base name shared by every context. The first cluster's context becomes
+// the current one. The returned function revokes the
+// -grant-verbs grants of every cluster.
+func generateAcrossKubeconfigs(ctx context.Context, config Config) (*api.Config, func(), error) {
+	combined := api.NewConfig()
+	var revokes []func()
+	revokeAll := func() {
+		for _, revoke := range revokes {
+			revoke()
+		}
+	}
+	for i, path := range config.Kubeconfigs {
+		source, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			revokeAll()
+			return nil, nil, fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+		}
+		sourceContext := source.Contexts[source.CurrentContext]
+		if sourceContext == nil {
+			revokeAll()
+			return nil, nil, fmt.Errorf("no current context found in %s", path)
+		}
+
+		clusterConfig := config
+		clusterConfig.Kubeconfigs = nil
+		clusterConfig.KubeconfigPath = path
+		clusterConfig.ClusterName = sourceContext.Cluster
+		clusterConfig.ContextName = fmt.Sprintf("%s-%s", config.ContextName, config.ClusterPrefix+sourceContext.Cluster)
+		clusterConfig.SetCurrentContext = config.SetCurrentContext && i == 0
+
+		newConfig, revoke, err := generateKubeconfig(ctx, clusterConfig)
+		if err != nil {
+			revokeAll()
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		revokes = append(revokes, revoke)
+
+		// Every cluster has a user named after the ServiceAccount, so qualify it by cluster
+		user := authInfoName(clusterConfig)
+		qualified := fmt.Sprintf("%s-%s", user, config.ClusterPrefix+sourceContext.Cluster)
+		if authInfo, ok := newConfig.AuthInfos[user]; ok {
+			delete(newConfig.AuthInfos, user)
+			newConfig.AuthInfos[qualified] = authInfo
+			for _, kubeContext := range newConfig.Contexts {
+				if kubeContext.AuthInfo == user {
+					kubeContext.AuthInfo = qualified
+				}
+			}
+		}
+
+		// Clusters of the same name in different files are kept apart by renaming
+		mergeKubeconfig(combined, newConfig, "rename", false)
+	}
+	return combined, revokeAll, nil
+}
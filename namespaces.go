@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceAllowed reports whether a namespace passes -namespaces-allow and
+// -namespaces-deny, which take glob patterns such as team-*; deny wins over allow
+func namespaceAllowed(config Config, namespace string) bool {
+	for _, pattern := range config.NamespacesDeny {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return false
+		}
+	}
+	if len(config.NamespacesAllow) == 0 {
+		return true
+	}
+	for _, pattern := range config.NamespacesAllow {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// selectNamespaces returns the namespaces a bulk run covers: those matching
+// -namespace-selector, or else -namespaces or -namespace, filtered by the allow
+// and deny lists
+func selectNamespaces(ctx context.Context, clientset *kubernetes.Clientset, config Config) ([]string, error) {
+	candidates := config.Namespaces
+	if len(candidates) == 0 {
+		candidates = []string{config.Namespace}
+	}
+
+	if config.NamespaceSelector != "" {
+		namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: config.NamespaceSelector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %ss matching %q: %w", namespaceTerm(config), config.NamespaceSelector, err)
+		}
+		candidates = nil
+		for _, namespace := range namespaces.Items {
+			candidates = append(candidates, namespace.Name)
+		}
+	}
+
+	var selected []string
+	for _, namespace := range candidates {
+		if namespaceAllowed(config, namespace) {
+			selected = append(selected, namespace)
+		} else {
+			logger.Infof("namespaces", "Skipping %s %s excluded by -namespaces-allow/-namespaces-deny", namespaceTerm(config), namespace)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// openShiftTokenSecretAnnotation links an OpenShift dockercfg secret to its token secret
+const openShiftTokenSecretAnnotation = "openshift.io/token-secret.name"
+
+// cliBinary returns the CLI used to request tokens: oc for OpenShift, kubectl otherwise
+func cliBinary(config Config) string {
+	if config.OpenShift {
+		return "oc"
+	}
+	return "kubectl"
+}
+
+// namespaceTerm returns what namespaces are called in messages: projects on OpenShift
+func namespaceTerm(config Config) string {
+	if config.OpenShift {
+		return "project"
+	}
+	return "namespace"
+}
+
+// openShiftTokenSecretName finds the token secret of an OpenShift ServiceAccount.
+// OpenShift lists a <sa>-dockercfg-* pull secret alongside (often before) the
+// <sa>-token-* secret, and newer releases only reference the token secret through
+// an annotation on the dockercfg secret.
+func openShiftTokenSecretName(ctx context.Context, clientset kubernetes.Interface, namespace string, sa *corev1.ServiceAccount) string {
+	for _, ref := range sa.Secrets {
+		if strings.Contains(ref.Name, "-token-") {
+			return ref.Name
+		}
+	}
+
+	for _, ref := range sa.Secrets {
+		if !strings.Contains(ref.Name, "-dockercfg-") {
+			continue
+		}
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		if name := secret.Annotations[openShiftTokenSecretAnnotation]; name != "" {
+			return name
+		}
+	}
+
+	return sa.Secrets[0].Name
+}
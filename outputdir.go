@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// checkOutputDirectory reports a parent directory of path that other users can
+// read or write, where a private kubeconfig is still exposed to listing, replacement
+// or symlink tricks. mode is warn, error or off.
+func checkOutputDirectory(path, mode string) error {
+	// Windows does not map ACLs onto permission bits
+	if mode == "off" || runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		// Missing directories are created with safe permissions later
+		return nil
+	}
+
+	var problem string
+	switch perm := info.Mode().Perm(); {
+	case perm&0002 != 0:
+		problem = "world-writable"
+	case perm&0004 != 0:
+		problem = "world-readable"
+	default:
+		return nil
+	}
+
+	if mode == "error" {
+		return fmt.Errorf("output directory %s is %s (mode %04o), refusing to write credentials there", dir, problem, info.Mode().Perm())
+	}
+	logger.Warnf("write", "Output directory %s is %s (mode %04o), consider a private directory for credentials", dir, problem, info.Mode().Perm())
+	return nil
+}
+
+// checkOutputLocation checks the directory of the file outputKubeconfig writes,
+// before any token is written or handed to a -store. -strict refuses like
+// -output-dir-check error rather than failing after the write.
+func checkOutputLocation(config Config) error {
+	if config.Install || config.SplitOutputDir != "" {
+		return nil
+	}
+	path := config.OutputPath
+	if config.PreviewPath != "" {
+		path = config.PreviewPath
+	}
+
+	// Named pipes hand the kubeconfig straight to a reader, whatever their directory
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		return nil
+	}
+
+	mode := config.OutputDirCheck
+	if config.Strict && mode == "warn" {
+		mode = "error"
+	}
+	return checkOutputDirectory(path, mode)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// resolveOwner resolves a user[:group] spec, by name or numeric ID, to a uid and gid.
+// The gid is -1 (unchanged) when no group is given.
+func resolveOwner(owner string) (int, int, error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+
+	uid, err := strconv.Atoi(userName)
+	if err != nil {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to look up user %s: %w", userName, err)
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("user %s has non-numeric uid %s", userName, u.Uid)
+		}
+	}
+
+	if groupName == "" {
+		return uid, -1, nil
+	}
+
+	gid, err := strconv.Atoi(groupName)
+	if err != nil {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to look up group %s: %w", groupName, err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("group %s has non-numeric gid %s", groupName, g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// chownOutput sets the owner of the generated file, warning instead of failing when
+// not running as root
+func chownOutput(path, owner string) error {
+	uid, gid, err := resolveOwner(owner)
+	if err != nil {
+		return err
+	}
+
+	if os.Geteuid() != 0 {
+		logger.Warnf("write", "Not running as root, leaving ownership of %s unchanged", path)
+		return nil
+	}
+
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of %s: %w", path, err)
+	}
+	return nil
+}
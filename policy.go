@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// policyContext describes the generation a policy is evaluated for
+type policyContext struct {
+	// config is the configuration the kubeconfig was generated with
+	config Config
+	// now is the time the policy is evaluated at
+	now time.Time
+}
+
+// policyFunc inspects a generated kubeconfig before it is written and returns an
+// error to reject it
+type policyFunc func(*api.Config, policyContext) error
+
+// parsePolicy returns the built-in -policy with the given spec: no-insecure,
+// max-expiry=DURATION or require-namespace=NAMESPACE
+func parsePolicy(spec string) (policyFunc, error) {
+	name, value, _ := strings.Cut(spec, "=")
+	switch name {
+	case "no-insecure":
+		return noInsecurePolicy, nil
+	case "max-expiry":
+		maxExpiry, err := time.ParseDuration(value)
+		if err != nil || maxExpiry <= 0 {
+			return nil, fmt.Errorf("max-expiry needs a positive duration such as 24h, got %q", value)
+		}
+		return maxExpiryPolicy(maxExpiry), nil
+	case "require-namespace":
+		if value == "" {
+			return nil, fmt.Errorf("require-namespace needs a namespace")
+		}
+		return requireNamespacePolicy(value), nil
+	default:
+		return nil, fmt.Errorf("unknown policy %q, expected no-insecure, max-expiry=DURATION or require-namespace=NAMESPACE", spec)
+	}
+}
+
+// noInsecurePolicy rejects clusters that skip TLS verification
+func noInsecurePolicy(kubeconfig *api.Config, _ policyContext) error {
+	for _, name := range sortedKeys(kubeconfig.Clusters) {
+		if kubeconfig.Clusters[name].InsecureSkipTLSVerify {
+			return fmt.Errorf("cluster %s skips TLS verification", name)
+		}
+	}
+	return nil
+}
+
+// maxExpiryPolicy rejects tokens valid for longer than maxExpiry, including tokens
+// whose expiry cannot be read or that never expire
+func maxExpiryPolicy(maxExpiry time.Duration) policyFunc {
+	return func(kubeconfig *api.Config, evaluation policyContext) error {
+		for _, name := range sortedKeys(kubeconfig.AuthInfos) {
+			token := kubeconfig.AuthInfos[name].Token
+			if token == "" {
+				continue
+			}
+			expiry, err := kubetoken.Expiry(token)
+			if err != nil {
+				return fmt.Errorf("token of user %s has no readable expiry: %v", name, err)
+			}
+			if remaining := expiry.Sub(evaluation.now); remaining > maxExpiry {
+				return fmt.Errorf("token of user %s is valid for %s, more than %s", name, remaining.Round(time.Minute), maxExpiry)
+			}
+		}
+		return nil
+	}
+}
+
+// requireNamespacePolicy rejects contexts defaulting to any other namespace
+func requireNamespacePolicy(namespace string) policyFunc {
+	return func(kubeconfig *api.Config, _ policyContext) error {
+		for _, name := range sortedKeys(kubeconfig.Contexts) {
+			if kubeContext := kubeconfig.Contexts[name]; kubeContext.Namespace != namespace {
+				return fmt.Errorf("context %s uses namespace %q, %q is required", name, kubeContext.Namespace, namespace)
+			}
+		}
+		return nil
+	}
+}
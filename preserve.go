@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// preservedAttributes are the mode and owner of a file that is about to be overwritten
+type preservedAttributes struct {
+	mode     os.FileMode
+	uid, gid int
+	hasOwner bool
+}
+
+// capturePreservedAttributes reads the mode and owner of an existing file. It
+// returns nil when the file does not exist yet.
+func capturePreservedAttributes(path string) (*preservedAttributes, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	attrs := &preservedAttributes{mode: info.Mode().Perm()}
+	attrs.uid, attrs.gid, attrs.hasOwner = fileOwner(info)
+	return attrs, nil
+}
+
+// restore reapplies the preserved mode and owner to path
+func (a *preservedAttributes) restore(path string) error {
+	if err := os.Chmod(path, a.mode); err != nil {
+		return fmt.Errorf("failed to restore permissions of %s: %w", path, err)
+	}
+	if a.hasOwner {
+		if err := os.Chown(path, a.uid, a.gid); err != nil {
+			return fmt.Errorf("failed to restore owner of %s: %w", path, err)
+		}
+	}
+	return nil
+}
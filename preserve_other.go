@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileOwner is not supported on this platform
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
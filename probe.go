@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// probeServer checks that the generated cluster's server answers like a Kubernetes
+// API server, using the cluster's CA and TLS settings but no credentials
+func probeServer(ctx context.Context, cluster *api.Cluster, config Config) error {
+	probeConfig := &rest.Config{
+		Host: cluster.Server,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData:     cluster.CertificateAuthorityData,
+			Insecure:   cluster.InsecureSkipTLSVerify,
+			ServerName: cluster.TLSServerName,
+		},
+	}
+	if err := configureClient(probeConfig, config); err != nil {
+		return err
+	}
+	client, err := rest.HTTPClientFor(probeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create probe client: %w", err)
+	}
+
+	// /version is usually readable anonymously; fall back to the issuer discovery
+	// document for clusters that only expose that publicly
+	versionErr := probeEndpoint(ctx, client, cluster.Server, "/version", "gitVersion")
+	if versionErr == nil {
+		return nil
+	}
+	if err := probeEndpoint(ctx, client, cluster.Server, "/.well-known/openid-configuration", "issuer"); err != nil {
+		return fmt.Errorf("server %s does not look like a Kubernetes API server: %v; %v", cluster.Server, versionErr, err)
+	}
+	return nil
+}
+
+// probeEndpoint GETs path on server and expects a JSON object with the given field,
+// or a Kubernetes Status object when anonymous access is rejected
+func probeEndpoint(ctx context.Context, client *http.Client, server, path, field string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	defer response.Body.Close()
+
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&body); err != nil {
+		return fmt.Errorf("GET %s: %s with a non-JSON response", path, response.Status)
+	}
+
+	if response.StatusCode == http.StatusOK && body[field] != nil {
+		return nil
+	}
+	if body["kind"] == "Status" && (response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+	return fmt.Errorf("GET %s: unexpected %s response", path, response.Status)
+}
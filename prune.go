@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// runPrune implements the prune operation, which removes users with expired
+// tokens, and the contexts using them, from an accumulated kubeconfig
+func runPrune(ctx context.Context, args []string) error {
+	var path string
+	var minify, dryRun bool
+
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags.StringVar(&path, "kubeconfig", defaultKubeconfigPath(), "Path to the kubeconfig file to prune")
+	flags.BoolVar(&minify, "minify", false, "Also remove clusters no remaining context refers to")
+	flags.BoolVar(&dryRun, "dry-run", false, "Report what would be removed without writing the kubeconfig")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	kubeconfig, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	if removed := pruneExpired(os.Stdout, kubeconfig, time.Now(), minify); removed == 0 || dryRun {
+		return nil
+	}
+	return writeKubeconfig(ctx, kubeconfig, path)
+}
+
+// pruneExpired deletes users whose JWT expired before now along with their contexts,
+// and with minify the clusters left unreferenced, reporting each removal. Opaque and
+// non-token credentials are kept. It returns the number of removed entries.
+func pruneExpired(w io.Writer, kubeconfig *api.Config, now time.Time, minify bool) int {
+	removed := 0
+	pruned := map[string]bool{}
+
+	for _, name := range sortedKeys(kubeconfig.AuthInfos) {
+		token := kubeconfig.AuthInfos[name].Token
+		if token == "" {
+			continue
+		}
+		expired, expiry, err := kubetoken.Expired(token, now)
+		if err != nil || !expired {
+			continue
+		}
+
+		delete(kubeconfig.AuthInfos, name)
+		pruned[name] = true
+		removed++
+		fmt.Fprintf(w, "Removed user %s (token expired %s)\n", name, expiry.Format(time.RFC3339))
+	}
+
+	for _, name := range sortedKeys(kubeconfig.Contexts) {
+		if !pruned[kubeconfig.Contexts[name].AuthInfo] {
+			continue
+		}
+		delete(kubeconfig.Contexts, name)
+		removed++
+		fmt.Fprintf(w, "Removed context %s\n", name)
+		if kubeconfig.CurrentContext == name {
+			kubeconfig.CurrentContext = ""
+			fmt.Fprintf(w, "Unset current-context %s\n", name)
+		}
+	}
+
+	if minify {
+		used := map[string]bool{}
+		for _, kubeContext := range kubeconfig.Contexts {
+			used[kubeContext.Cluster] = true
+		}
+		for _, name := range sortedKeys(kubeconfig.Clusters) {
+			if used[name] {
+				continue
+			}
+			delete(kubeconfig.Clusters, name)
+			removed++
+			fmt.Fprintf(w, "Removed cluster %s\n", name)
+		}
+	}
+
+	if removed == 0 {
+		fmt.Fprintln(w, "Nothing to prune")
+	}
+	return removed
+}
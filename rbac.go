@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// bindsServiceAccount reports whether subjects include the ServiceAccount, directly
+// or through one of the groups every ServiceAccount token carries
+func bindsServiceAccount(subjects []rbacv1.Subject, namespace, name string) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			if subject.Name == name && subject.Namespace == namespace {
+				return true
+			}
+		case rbacv1.GroupKind:
+			switch subject.Name {
+			case "system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyableMeta strips the server-populated fields from an object's metadata so the
+// manifest can be applied to another cluster
+func applyableMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+// emitRBAC writes the RoleBindings and ClusterRoleBindings referencing the
+// ServiceAccount, along with the roles they bind, as a multi-document YAML manifest
+func emitRBAC(ctx context.Context, clientset *kubernetes.Clientset, config Config) error {
+	var objects []interface{}
+	roles := map[string]bool{}
+	clusterRoles := map[string]bool{}
+
+	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list ClusterRoleBindings: %w", err)
+	}
+	for _, binding := range clusterRoleBindings.Items {
+		if !bindsServiceAccount(binding.Subjects, config.Namespace, config.ServiceAccountName) {
+			continue
+		}
+		binding.TypeMeta = metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"}
+		binding.ObjectMeta = applyableMeta(binding.ObjectMeta)
+		objects = append(objects, binding)
+		clusterRoles[binding.RoleRef.Name] = true
+	}
+
+	roleBindings, err := clientset.RbacV1().RoleBindings(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list RoleBindings: %w", err)
+	}
+	for _, binding := range roleBindings.Items {
+		if !bindsServiceAccount(binding.Subjects, config.Namespace, config.ServiceAccountName) {
+			continue
+		}
+		binding.TypeMeta = metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"}
+		binding.ObjectMeta = applyableMeta(binding.ObjectMeta)
+		objects = append(objects, binding)
+		if binding.RoleRef.Kind == "ClusterRole" {
+			clusterRoles[binding.RoleRef.Name] = true
+		} else {
+			roles[binding.Namespace+"/"+binding.RoleRef.Name] = true
+		}
+	}
+
+	// Include the roles themselves so the manifest documents the effective permissions
+	for _, name := range sortedKeys(clusterRoles) {
+		role, err := clientset.RbacV1().ClusterRoles().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			logger.Warnf("rbac", "Failed to get ClusterRole %s: %v", name, err)
+			continue
+		}
+		role.TypeMeta = metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"}
+		role.ObjectMeta = applyableMeta(role.ObjectMeta)
+		objects = append(objects, role)
+	}
+	for _, ref := range sortedKeys(roles) {
+		namespace, name, _ := splitNamespacedName(ref)
+		role, err := clientset.RbacV1().Roles(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			logger.Warnf("rbac", "Failed to get Role %s: %v", ref, err)
+			continue
+		}
+		role.TypeMeta = metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"}
+		role.ObjectMeta = applyableMeta(role.ObjectMeta)
+		objects = append(objects, role)
+	}
+
+	if len(objects) == 0 {
+		logger.Warnf("rbac", "No RoleBindings or ClusterRoleBindings reference ServiceAccount %s/%s",
+			config.Namespace, config.ServiceAccountName)
+	}
+
+	var manifest bytes.Buffer
+	for _, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("failed to serialize RBAC manifest: %w", err)
+		}
+		manifest.WriteString("---\n")
+		manifest.Write(data)
+	}
+
+	if err := writeFileAtomic(ctx, config.EmitRBAC, manifest.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write RBAC manifest: %w", err)
+	}
+	return nil
+}
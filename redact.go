@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// secretPattern matches JWTs and bearer tokens that must not end up in logs: any
+// Authorization header value, and otherwise only token-like values of 20 characters
+// or more after "bearer", so prose such as "bearer token from secret" is left alone
+var secretPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*|` +
+	`(?i:authorization:\s*bearer)\s+[A-Za-z0-9._~+/-]+=*|(?i:bearer)\s+[A-Za-z0-9._~+/-]{20,}=*`)
+
+// redactSecrets masks the middle of every token-like string in s, keeping the
+// "Authorization: Bearer" or "bearer" in front of it readable
+func redactSecrets(s string) string {
+	return secretPattern.ReplaceAllStringFunc(s, func(match string) string {
+		prefix, secret := "", match
+		if i := strings.LastIndexAny(match, " \t"); i >= 0 {
+			prefix, secret = match[:i+1], match[i+1:]
+		}
+		if len(secret) <= 16 {
+			return prefix + "..."
+		}
+		return prefix + secret[:10] + "..." + secret[len(secret)-4:]
+	})
+}
+
+// redactingWriter masks token-like strings in everything written through it
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, redactSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reportMintable lists every ServiceAccount in the selected namespaces and whether
+// the current identity may mint tokens for it, without minting any
+func reportMintable(ctx context.Context, w io.Writer, config Config) error {
+	clientset, err := newClientset(config)
+	if err != nil {
+		return err
+	}
+
+	namespaces, err := selectNamespaces(ctx, clientset, config)
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NAMESPACE\tSERVICEACCOUNT\tMINTABLE")
+	total, mintable := 0, 0
+	for _, namespace := range namespaces {
+		serviceAccounts, err := clientset.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list ServiceAccounts in %s %s: %w", namespaceTerm(config), namespace, err)
+		}
+
+		for _, serviceAccount := range serviceAccounts.Items {
+			allowed, err := canCreateToken(ctx, clientset, namespace, serviceAccount.Name)
+			if err != nil {
+				return fmt.Errorf("failed to check token permission for %s/%s: %w", namespace, serviceAccount.Name, err)
+			}
+
+			total++
+			if allowed {
+				mintable++
+			}
+			fmt.Fprintf(table, "%s\t%s\t%t\n", namespace, serviceAccount.Name, allowed)
+		}
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d of %d ServiceAccounts mintable\n", mintable, total)
+	return nil
+}
+
+// canCreateToken asks the API server whether the current identity may create
+// tokens for the named ServiceAccount
+func canCreateToken(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) (bool, error) {
+	review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx,
+		&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   namespace,
+					Verb:        "create",
+					Resource:    "serviceaccounts",
+					Subresource: "token",
+					Name:        name,
+				},
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
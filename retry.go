@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// retryableStatusMessages are the messages kubectl prints for retryable API statuses
+// (500, 503, 504 and 429), as kubectl only reports the status message
+var retryableStatusMessages = []string{
+	"Internal error occurred",
+	"the server is currently unable to handle the request",
+	"the server was unable to return a response in the time allotted",
+	"Too many requests",
+}
+
+// isRetryableTokenError reports whether a token request failed with a transient server error
+func isRetryableTokenError(err error) bool {
+	if apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) {
+		return true
+	}
+
+	for _, message := range retryableStatusMessages {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTokenRequest calls request, retrying up to -token-retries times with
+// -token-retry-delay between attempts while it fails with a retryable error
+func retryTokenRequest(ctx context.Context, config Config, request func() (string, error)) (string, error) {
+	token, err := request()
+	for attempt := 1; attempt <= config.TokenRetries && err != nil && isRetryableTokenError(err); attempt++ {
+		// Only exhausted retries warn, so a request that recovers does not fail -strict
+		logger.Infof("token", "Token request failed, retrying (%d/%d): %v", attempt, config.TokenRetries, err)
+
+		select {
+		case <-time.After(config.TokenRetryDelay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		token, err = request()
+	}
+	if err != nil && config.TokenRetries > 0 && isRetryableTokenError(err) {
+		logger.Warnf("token", "Token request still failing after %d retries: %v", config.TokenRetries, err)
+	}
+	return token, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// rotateSecretToken replaces the ServiceAccount token inside a kubeconfig stored
+// in a Secret, leaving the cluster and CA data untouched
+func rotateSecretToken(ctx context.Context, config Config) error {
+	namespace, name, err := splitNamespacedName(config.RotateSecret)
+	if err != nil {
+		return err
+	}
+
+	clientset, err := newClientset(config)
+	if err != nil {
+		return err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(
+		ctx,
+		name,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s: %w", config.RotateSecret, err)
+	}
+
+	data, compressed, err := secretKubeconfig(secret, config.RotateSecretKey)
+	if err != nil {
+		return err
+	}
+
+	storedConfig, err := clientcmd.Load(data)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig from secret %s: %w", config.RotateSecret, err)
+	}
+
+	authInfo := storedConfig.AuthInfos[authInfoName(config)]
+	if authInfo == nil {
+		return fmt.Errorf("user %s not found in kubeconfig stored in secret %s", authInfoName(config), config.RotateSecret)
+	}
+
+	// Mint a fresh token and swap it into the stored kubeconfig, keeping the current
+	// token when only validating the update with -server-dry-run
+	if !config.ServerDryRun {
+		token, err := getServiceAccountToken(ctx, clientset, config)
+		if err != nil {
+			return fmt.Errorf("failed to get token: %w", err)
+		}
+		authInfo.Token = token
+	} else if expired, expiry, err := kubetoken.Expired(authInfo.Token, time.Now()); err == nil && expired {
+		logger.Warnf("token", "The token kept in secret %s expired %s, run without -server-dry-run to replace it",
+			config.RotateSecret, expiry.Format(time.RFC3339))
+	}
+
+	if err := checkKubeconfig(config, storedConfig); err != nil {
+		return fmt.Errorf("refusing to update secret %s: %w", config.RotateSecret, err)
+	}
+
+	updated, err := clientcmd.Write(*storedConfig)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	// Keep a compressed kubeconfig compressed, and compress it when -compress is set
+	if err := storeSecretKubeconfig(secret, config.RotateSecretKey, updated, compressed || config.Compress); err != nil {
+		return err
+	}
+
+	if _, err := clientset.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{DryRun: dryRun(config)}); err != nil {
+		return fmt.Errorf("failed to update secret %s: %w", config.RotateSecret, err)
+	}
+
+	return nil
+}
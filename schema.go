@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runSchema implements the hidden schema operation, which prints a JSON Schema of the
+// JSON arguments files accepted as @FILE.json, for tools that build or validate
+// generation specs. It runs once the flags are defined, so the schema follows them.
+func runSchema(flags *flag.FlagSet, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("schema takes no arguments")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(flagsSchema(flags))
+}
+
+// flagsSchema derives a JSON Schema with one property per flag, named after the flag
+// without its dash
+func flagsSchema(flags *flag.FlagSet) map[string]interface{} {
+	properties := map[string]interface{}{}
+	flags.VisitAll(func(f *flag.Flag) {
+		schema := valueSchema(f.Value)
+		schema["description"] = f.Usage
+		properties[f.Name] = schema
+	})
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "kubeconfig-generator arguments",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// valueSchema returns the JSON Schema of a flag's value
+func valueSchema(value flag.Value) map[string]interface{} {
+	if _, ok := value.(*stringList); ok {
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	}
+
+	getter, ok := value.(flag.Getter)
+	if !ok {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch getter.Get().(type) {
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case int, int64, uint, uint64:
+		return map[string]interface{}{"type": "integer"}
+	case time.Duration:
+		return map[string]interface{}{"type": "string", "pattern": `^(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
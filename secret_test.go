@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// tokenSecret returns a populated ServiceAccount token secret annotated for sa
+func tokenSecret(name string, sa *corev1.ServiceAccount, token string, created time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         sa.Namespace,
+			CreationTimestamp: metav1.NewTime(created),
+			Annotations: map[string]string{
+				corev1.ServiceAccountNameKey: sa.Name,
+				corev1.ServiceAccountUIDKey:  string(sa.UID),
+			},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{"token": []byte(token)},
+	}
+}
+
+func TestGetTokenFromSecretDefaultServiceAccount(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		sa      *corev1.ServiceAccount
+		secrets func(sa *corev1.ServiceAccount) []*corev1.Secret
+		want    string
+		wantErr bool
+	}{
+		{
+			// Before 1.24 the token controller lists the secret on the ServiceAccount
+			name: "listed token secret",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "apps", UID: "uid-1"},
+				Secrets:    []corev1.ObjectReference{{Name: "default-token-abcde"}},
+			},
+			secrets: func(sa *corev1.ServiceAccount) []*corev1.Secret {
+				return []*corev1.Secret{tokenSecret("default-token-abcde", sa, "listed-token", now)}
+			},
+			want: "listed-token",
+		},
+		{
+			// Since 1.24 a token secret for legacy apps is created by hand and only annotated
+			name: "annotated token secret",
+			sa:   &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "apps", UID: "uid-2"}},
+			secrets: func(sa *corev1.ServiceAccount) []*corev1.Secret {
+				stale := tokenSecret("default-token-stale", sa, "stale-token", now)
+				stale.Annotations[corev1.ServiceAccountUIDKey] = "uid-of-deleted-sa"
+				return []*corev1.Secret{stale, tokenSecret("default-token-abcde", sa, "annotated-token", now)}
+			},
+			want: "annotated-token",
+		},
+		{
+			// A listed secret without the ServiceAccount annotations is still used
+			name: "listed secret without annotations",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "apps", UID: "uid-4"},
+				Secrets:    []corev1.ObjectReference{{Name: "default-token-legacy"}},
+			},
+			secrets: func(sa *corev1.ServiceAccount) []*corev1.Secret {
+				legacy := tokenSecret("default-token-legacy", sa, "legacy-token", now)
+				legacy.Annotations = nil
+				return []*corev1.Secret{legacy}
+			},
+			want: "legacy-token",
+		},
+		{
+			name:    "no token secret",
+			sa:      &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "apps", UID: "uid-3"}},
+			secrets: func(sa *corev1.ServiceAccount) []*corev1.Secret { return nil },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tt.sa)
+			for _, secret := range tt.secrets(tt.sa) {
+				if _, err := clientset.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			token, err := getTokenFromSecret(context.Background(), clientset, Config{ServiceAccountName: "default", Namespace: "apps"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got token %q", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if token != tt.want {
+				t.Errorf("got token %q, want %q", token, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiServerFromService builds the API server URL from the ingress of a LoadBalancer
+// Service. It returns an empty string when the Service has no ingress yet.
+func apiServerFromService(ctx context.Context, clientset *kubernetes.Clientset, ref string) (string, error) {
+	namespace, name, err := splitNamespacedName(ref)
+	if err != nil {
+		return "", err
+	}
+
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get service %s: %w", ref, err)
+	}
+
+	if len(service.Status.LoadBalancer.Ingress) == 0 {
+		return "", nil
+	}
+	if len(service.Spec.Ports) == 0 {
+		return "", fmt.Errorf("service %s has no ports", ref)
+	}
+
+	ingress := service.Status.LoadBalancer.Ingress[0]
+	host := ingress.Hostname
+	if host == "" {
+		host = ingress.IP
+	}
+
+	return "https://" + net.JoinHostPort(host, strconv.Itoa(int(service.Spec.Ports[0].Port))), nil
+}
+
+// overrideServerAddress replaces the host and/or port of a server URL, keeping its
+// scheme and path, for API servers reached through NAT or a different hostname
+func overrideServerAddress(server, host, port string) (string, error) {
+	serverURL, err := url.Parse(server)
+	if err != nil || serverURL.Host == "" {
+		return "", fmt.Errorf("cannot override host or port of server %q: not a valid URL", server)
+	}
+
+	if host == "" {
+		host = serverURL.Hostname()
+	}
+	if port == "" {
+		port = serverURL.Port()
+	}
+	if port == "" {
+		serverURL.Host = host
+		if strings.Contains(host, ":") {
+			serverURL.Host = "[" + host + "]"
+		}
+	} else {
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return "", fmt.Errorf("invalid server port %q", port)
+		}
+		serverURL.Host = net.JoinHostPort(host, port)
+	}
+
+	// Make sure the result is still a usable URL
+	if _, err := url.Parse(serverURL.String()); err != nil {
+		return "", fmt.Errorf("overridden server URL %q is invalid: %w", serverURL.String(), err)
+	}
+	return serverURL.String(), nil
+}
+
+// resolveServerHostname looks up the PTR record of a server URL's IP address. Depending
+// on mode it returns the URL with the hostname in place of the IP ("server") or the
+// unchanged URL plus the hostname to use as tls-server-name ("tls-server-name"). Servers
+// given by hostname, or IPs without a PTR record, are returned unchanged.
+func resolveServerHostname(ctx context.Context, server, mode string) (string, string, error) {
+	serverURL, err := url.Parse(server)
+	if err != nil || serverURL.Host == "" {
+		return "", "", fmt.Errorf("cannot resolve hostname of server %q: not a valid URL", server)
+	}
+	ip := serverURL.Hostname()
+	if net.ParseIP(ip) == nil {
+		return server, "", nil
+	}
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		logger.Warnf("server", "No PTR record found for %s, keeping the IP address", ip)
+		return server, "", nil
+	}
+	hostname := strings.TrimSuffix(names[0], ".")
+
+	if mode == "tls-server-name" {
+		return server, hostname, nil
+	}
+	if port := serverURL.Port(); port != "" {
+		serverURL.Host = net.JoinHostPort(hostname, port)
+	} else {
+		serverURL.Host = hostname
+	}
+	return serverURL.String(), "", nil
+}
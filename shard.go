@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// unsafeShardSuffix matches the runs of characters not kept in a shard file suffix,
+// such as the / and : of EKS cluster ARNs
+var unsafeShardSuffix = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// shardSuffix turns a cluster name into a file name suffix that cannot leave the
+// output directory or break the KUBECONFIG list
+func shardSuffix(cluster string) string {
+	suffix := unsafeShardSuffix.ReplaceAllString(cluster, "-")
+	return strings.ReplaceAll(suffix, "..", "-")
+}
+
+// kubeconfigShard is one file of a sharded kubeconfig
+type kubeconfigShard struct {
+	suffix   string
+	contexts []string
+}
+
+// shardContexts groups the contexts of newConfig into shards, one per cluster with
+// -shard-by cluster, each holding at most size contexts when size is positive
+func shardContexts(newConfig *api.Config, by string, size int) []kubeconfigShard {
+	groups := map[string][]string{}
+	for _, name := range sortedKeys(newConfig.Contexts) {
+		key := ""
+		if by == "cluster" {
+			key = newConfig.Contexts[name].Cluster
+		}
+		groups[key] = append(groups[key], name)
+	}
+
+	var shards []kubeconfigShard
+	used := map[string]bool{}
+	for _, key := range sortedKeys(groups) {
+		contexts := groups[key]
+
+		// Keep clusters whose names only differ in replaced characters apart
+		prefix := shardSuffix(key)
+		for i := 2; key != "" && used[prefix]; i++ {
+			prefix = fmt.Sprintf("%s-%d", shardSuffix(key), i)
+		}
+		used[prefix] = true
+
+		if size <= 0 {
+			shards = append(shards, kubeconfigShard{suffix: prefix, contexts: contexts})
+			continue
+		}
+		for i := 0; i*size < len(contexts); i++ {
+			end := min((i+1)*size, len(contexts))
+			suffix := fmt.Sprintf("%d", i+1)
+			if prefix != "" {
+				suffix = prefix + "-" + suffix
+			}
+			shards = append(shards, kubeconfigShard{suffix: suffix, contexts: contexts[i*size : end]})
+		}
+	}
+	return shards
+}
+
+// shardConfig returns the part of newConfig with the given contexts and the clusters
+// and users they reference
+func shardConfig(newConfig *api.Config, contexts []string) *api.Config {
+	shard := api.NewConfig()
+	for _, name := range contexts {
+		kubeContext := newConfig.Contexts[name]
+		shard.Contexts[name] = kubeContext
+		if cluster, ok := newConfig.Clusters[kubeContext.Cluster]; ok {
+			shard.Clusters[kubeContext.Cluster] = cluster
+		}
+		if authInfo, ok := newConfig.AuthInfos[kubeContext.AuthInfo]; ok {
+			shard.AuthInfos[kubeContext.AuthInfo] = authInfo
+		}
+		if name == newConfig.CurrentContext {
+			shard.CurrentContext = name
+		}
+	}
+	return shard
+}
+
+// writeShardedOutput writes each shard of the kubeconfig to <path>-<shard> and
+// reports which file holds which contexts, with the KUBECONFIG value joining them
+func writeShardedOutput(ctx context.Context, config Config, newConfig *api.Config, path string) error {
+	var paths []string
+	for _, shard := range shardContexts(newConfig, config.ShardBy, config.ShardSize) {
+		shardPath := path
+		if shard.suffix != "" {
+			shardPath = fmt.Sprintf("%s-%s", path, shard.suffix)
+		}
+		if err := writeKubeconfig(ctx, shardConfig(newConfig, shard.contexts), shardPath); err != nil {
+			return err
+		}
+		paths = append(paths, shardPath)
+		logger.Infof("write", "%s: %s", shardPath, strings.Join(shard.contexts, ", "))
+	}
+
+	logger.Infof("write", "Use with: export KUBECONFIG=%s", strings.Join(paths, string(os.PathListSeparator)))
+	return nil
+}
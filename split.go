@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// writeSplitOutput writes the kubeconfig along with its token, CA certificate and
+// server URL as individual files into the -split-output directory
+func writeSplitOutput(ctx context.Context, config Config, newConfig *api.Config) error {
+	dir := config.SplitOutputDir
+
+	kubeContext := newConfig.Contexts[primaryContextName(config)]
+	if kubeContext == nil {
+		return fmt.Errorf("generated kubeconfig has no context %s", primaryContextName(config))
+	}
+	cluster := newConfig.Clusters[kubeContext.Cluster]
+	authInfo := newConfig.AuthInfos[kubeContext.AuthInfo]
+	if cluster == nil || authInfo == nil {
+		return fmt.Errorf("generated context %s references a missing cluster or user", primaryContextName(config))
+	}
+
+	if err := writeKubeconfig(ctx, newConfig, filepath.Join(dir, "kubeconfig")); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{"token", []byte(authInfo.Token), 0600},
+		{"ca.crt", cluster.CertificateAuthorityData, 0644},
+		{"server.txt", []byte(cluster.Server + "\n"), 0644},
+	}
+	for _, file := range files {
+		if len(file.data) == 0 {
+			logger.Warnf("write", "No data for %s, skipping", file.name)
+			continue
+		}
+		path := filepath.Join(dir, file.name)
+		if err := writeOutputFile(ctx, path, file.data, file.perm); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// readServiceAccountNames reads ServiceAccount names one per line, skipping blank
+// lines and # comments and accepting kubectl's serviceaccount/<name> form
+func readServiceAccountNames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "serviceaccount/")
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ServiceAccount names: %w", err)
+	}
+	return names, nil
+}
+
+// generateForNames generates a kubeconfig for each ServiceAccount named in r, written
+// to <output>-<name>, and reports the result per name
+func generateForNames(ctx context.Context, r io.Reader, config Config) error {
+	names, err := readServiceAccountNames(r)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no ServiceAccount names read from stdin")
+	}
+
+	failed := 0
+	for _, name := range names {
+		nameConfig := config
+		nameConfig.ServiceAccountName = name
+		nameConfig.OutputPath = fmt.Sprintf("%s-%s", config.OutputPath, name)
+		if nameConfig.ContextName == "" {
+			nameConfig.ContextName = fmt.Sprintf("%s-context", name)
+		}
+		nameConfig.ContextName = config.ContextPrefix + nameConfig.ContextName
+
+		start := time.Now()
+		generator := NewGenerator(nameConfig)
+		err := generator.Generate(ctx)
+		recordGeneration(nameConfig, time.Since(start), err)
+		if err != nil {
+			failed++
+			logger.Warnf("generate", "%s: %v", name, err)
+			continue
+		}
+		reportOutput(nameConfig, generator.Kubeconfig)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d ServiceAccounts failed", failed, len(names))
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// credentialStoreService is the service name tokens are saved under in the OS keyring
+const credentialStoreService = "kubeconfig-generator"
+
+// CredentialStore saves tokens outside the kubeconfig and reads them back
+type CredentialStore interface {
+	Save(ctx context.Context, account, token string) error
+	Load(ctx context.Context, account string) (string, error)
+}
+
+// newCredentialStore returns the -store backend with the given name
+func newCredentialStore(name string) (CredentialStore, error) {
+	switch name {
+	case "keyring":
+		return keyringStore{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported credential store %q, expected keyring", name)
+	}
+}
+
+// keyringStore keeps tokens in the OS keyring through the macOS security tool or
+// the freedesktop Secret Service (secret-tool) elsewhere
+type keyringStore struct{}
+
+func (k keyringStore) Save(ctx context.Context, account, token string) error {
+	if runtime.GOOS != "darwin" {
+		cmd := exec.CommandContext(ctx, "secret-tool", "store", "--label", credentialStoreService+" "+account,
+			"service", credentialStoreService, "account", account)
+		cmd.Stdin = strings.NewReader(token)
+		return runKeyringCommand(cmd)
+	}
+
+	// security only takes the password as an argument, so pass the whole command on
+	// stdin in interactive mode to keep the token out of the process list
+	if !opaqueTokenPattern.MatchString(token) || strings.ContainsAny(account, "\"\\\n") {
+		return fmt.Errorf("token or account %q cannot be passed to security safely", account)
+	}
+	cmd := exec.CommandContext(ctx, "security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -w \"%s\"\n",
+		credentialStoreService, account, token))
+	if err := runKeyringCommand(cmd); err != nil {
+		return err
+	}
+
+	// Interactive mode exits successfully even when the command fails
+	if stored, err := k.Load(ctx, account); err != nil || stored != token {
+		return fmt.Errorf("security did not store the token for %s", account)
+	}
+	return nil
+}
+
+func (keyringStore) Load(ctx context.Context, account string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password",
+			"-s", credentialStoreService, "-a", account, "-w")
+	} else {
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", credentialStoreService, "account", account)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := runKeyringCommand(cmd); err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(out.String())
+	if token == "" {
+		return "", fmt.Errorf("no token stored for %s", account)
+	}
+	return token, nil
+}
+
+// runKeyringCommand runs a keyring tool, including its stderr in errors
+func runKeyringCommand(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, message)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// execSelfPath returns the command written into exec hooks that run this binary:
+// -exec-self-path, or else the absolute, symlink-resolved path of the running binary
+func execSelfPath(config Config) (string, error) {
+	if config.ExecSelfPath != "" {
+		return config.ExecSelfPath, nil
+	}
+
+	self, err := os.Executable()
+	if err == nil {
+		self, err = filepath.EvalSymlinks(self)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to locate this executable for the exec hook, set -exec-self-path: %w", err)
+	}
+	return self, nil
+}
+
+// storeAccount names the credential store entry of a user after the cluster its
+// context points at and the ServiceAccount's namespace, so same-named users of
+// different clusters (e.g. with -kubeconfigs) keep separate entries
+func storeAccount(newConfig *api.Config, namespace, user string) string {
+	cluster := ""
+	for _, name := range sortedKeys(newConfig.Contexts) {
+		if kubeContext := newConfig.Contexts[name]; kubeContext.AuthInfo == user {
+			cluster = kubeContext.Cluster
+			break
+		}
+	}
+	return fmt.Sprintf("%s/%s/%s", cluster, namespace, user)
+}
+
+// moveTokensToStore saves each user's token in the credential store and replaces it
+// with an exec hook that runs this binary's credential operation to read it back
+func moveTokensToStore(ctx context.Context, config Config, newConfig *api.Config) error {
+	store, err := newCredentialStore(config.Store)
+	if err != nil {
+		return err
+	}
+	self, err := execSelfPath(config)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range sortedKeys(newConfig.AuthInfos) {
+		authInfo := newConfig.AuthInfos[name]
+		if authInfo.Token == "" {
+			continue
+		}
+
+		account := storeAccount(newConfig, config.Namespace, name)
+		if err := store.Save(ctx, account, authInfo.Token); err != nil {
+			return fmt.Errorf("failed to save token for %s in %s: %w", name, config.Store, err)
+		}
+
+		authInfo.Token = ""
+		authInfo.Exec = &api.ExecConfig{
+			Command:         self,
+			Args:            []string{"credential", "-store", config.Store, "-account", account},
+			APIVersion:      "client.authentication.k8s.io/v1",
+			InteractiveMode: api.NeverExecInteractiveMode,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestStoreAccountPerCluster(t *testing.T) {
+	newConfig := api.NewConfig()
+	for _, cluster := range []string{"eu", "us"} {
+		newConfig.Clusters[cluster] = &api.Cluster{Server: "https://" + cluster + ".example.com"}
+		newConfig.AuthInfos["app-"+cluster] = &api.AuthInfo{Token: "token-" + cluster}
+		newConfig.Contexts["app-context-"+cluster] = &api.Context{Cluster: cluster, AuthInfo: "app-" + cluster}
+	}
+	// A user whose ServiceAccount name is reused in another namespace
+	newConfig.AuthInfos["app"] = &api.AuthInfo{Token: "token"}
+	newConfig.Contexts["app-context"] = &api.Context{Cluster: "eu", AuthInfo: "app"}
+
+	eu := storeAccount(newConfig, "apps", "app-eu")
+	us := storeAccount(newConfig, "apps", "app-us")
+	if eu == us {
+		t.Fatalf("users of different clusters share the account %s", eu)
+	}
+	if eu != "eu/apps/app-eu" {
+		t.Errorf("got account %s, want eu/apps/app-eu", eu)
+	}
+
+	// Same user and cluster, different ServiceAccount namespace
+	if storeAccount(newConfig, "apps", "app") == storeAccount(newConfig, "ci", "app") {
+		t.Error("accounts do not include the namespace")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// generationSummary is the machine-readable result printed with -json
+type generationSummary struct {
+	Output   string   `json:"output"`
+	Context  string   `json:"context"`
+	Insecure bool     `json:"insecure"`
+	Warnings []string `json:"warnings"`
+}
+
+// writeSummary prints a JSON summary of the generated kubeconfig, flagging any
+// cluster that skips TLS verification
+func writeSummary(w io.Writer, config Config, newConfig *api.Config, warnings []string) error {
+	summary := generationSummary{
+		Output:   outputKubeconfigPath(config),
+		Context:  generatedContextName(config, newConfig),
+		Warnings: warnings,
+	}
+	if summary.Warnings == nil {
+		summary.Warnings = []string{}
+	}
+	for _, cluster := range newConfig.Clusters {
+		if cluster.InsecureSkipTLSVerify {
+			summary.Insecure = true
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
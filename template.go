@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// templateData are the fields available to a -template
+type templateData struct {
+	Server                string
+	CertificateAuthority  string // base64-encoded, as in a kubeconfig
+	InsecureSkipTLSVerify bool
+	Token                 string
+	Namespace             string
+	Context               string
+	Cluster               string
+	User                  string
+}
+
+// writeTemplateOutput renders the -template file with the primary context's fields
+// and writes the result to path instead of the kubeconfig
+func writeTemplateOutput(ctx context.Context, config Config, newConfig *api.Config, path string) error {
+	// Don't start writing once the operation has been cancelled
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not writing output: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(config.Template)).Option("missingkey=error").ParseFiles(config.Template)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	kubeContext := newConfig.Contexts[primaryContextName(config)]
+	if kubeContext == nil {
+		return fmt.Errorf("generated kubeconfig has no context %s", primaryContextName(config))
+	}
+	cluster := newConfig.Clusters[kubeContext.Cluster]
+	authInfo := newConfig.AuthInfos[kubeContext.AuthInfo]
+	if cluster == nil || authInfo == nil {
+		return fmt.Errorf("generated context %s references a missing cluster or user", primaryContextName(config))
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, templateData{
+		Server:                cluster.Server,
+		CertificateAuthority:  base64.StdEncoding.EncodeToString(cluster.CertificateAuthorityData),
+		InsecureSkipTLSVerify: cluster.InsecureSkipTLSVerify,
+		Token:                 authInfo.Token,
+		Namespace:             kubeContext.Namespace,
+		Context:               primaryContextName(config),
+		Cluster:               kubeContext.Cluster,
+		User:                  kubeContext.AuthInfo,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := writeOutputFile(ctx, path, out.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write rendered template: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// loadTokenRequestSpec reads a TokenRequest manifest. Fields unknown to this build are
+// ignored rather than rejected, so specs written against newer APIs still load.
+func loadTokenRequestSpec(path string) (*authenticationv1.TokenRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token request spec: %w", err)
+	}
+
+	request := &authenticationv1.TokenRequest{}
+	if err := yaml.Unmarshal(data, request); err != nil {
+		return nil, fmt.Errorf("failed to parse token request spec %s: %w", path, err)
+	}
+	return request, nil
+}
+
+// createTokenWithTokenRequest mints a token through the TokenRequest API directly,
+// without shelling out to kubectl
+func createTokenWithTokenRequest(ctx context.Context, clientset *kubernetes.Clientset, config Config) (string, error) {
+	request := &authenticationv1.TokenRequest{}
+	if config.TokenRequestSpec != "" {
+		var err error
+		if request, err = loadTokenRequestSpec(config.TokenRequestSpec); err != nil {
+			return "", err
+		}
+	}
+
+	// Flags are layered on top of the spec; -expiry already reflects the spec's
+	// expirationSeconds unless it was given explicitly
+	expirationSeconds := int64(config.TokenExpiryHours) * 3600
+	request.Spec.ExpirationSeconds = &expirationSeconds
+	if len(config.Audiences) > 0 {
+		request.Spec.Audiences = config.Audiences
+	}
+
+	response, err := clientset.CoreV1().ServiceAccounts(config.Namespace).CreateToken(
+		ctx,
+		config.ServiceAccountName,
+		request,
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Status.Token, nil
+}
+
+// reviewToken submits a token to the TokenReview API and returns the identity it
+// authenticates as, failing when the cluster does not accept it
+func reviewToken(ctx context.Context, clientset *kubernetes.Clientset, token string, audiences []string) (authenticationv1.UserInfo, error) {
+	review, err := clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: audiences,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("TokenReview failed: %w", err)
+	}
+
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return authenticationv1.UserInfo{}, fmt.Errorf("token is not accepted by the cluster: %s", review.Status.Error)
+		}
+		return authenticationv1.UserInfo{}, fmt.Errorf("token is not accepted by the cluster")
+	}
+	return review.Status.User, nil
+}
+
+// listAudiences mints a short-lived token without requesting audiences and prints the
+// audiences the API server filled in, which are its default (expected) audiences
+func listAudiences(ctx context.Context, w io.Writer, config Config) error {
+	clientset, err := newClientset(config)
+	if err != nil {
+		return err
+	}
+
+	// 10 minutes is the shortest expiry the TokenRequest API accepts
+	expirationSeconds := int64(600)
+	response, err := clientset.CoreV1().ServiceAccounts(config.Namespace).CreateToken(
+		ctx,
+		config.ServiceAccountName,
+		&authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expirationSeconds}},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to request a token: %w", err)
+	}
+
+	claims, err := kubetoken.Claims(response.Status.Token)
+	if err != nil {
+		return err
+	}
+
+	// aud is either a single string or a list of strings
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, audience := range aud {
+			if audience, ok := audience.(string); ok {
+				audiences = append(audiences, audience)
+			}
+		}
+	}
+	if len(audiences) == 0 {
+		return fmt.Errorf("token has no aud claim")
+	}
+
+	if issuer, ok := claims["iss"].(string); ok {
+		fmt.Fprintf(w, "Issuer: %s\n", issuer)
+	}
+	fmt.Fprintln(w, "Default audiences:")
+	for _, audience := range audiences {
+		fmt.Fprintf(w, "  %s\n", audience)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// TokenSource supplies the token written into the generated kubeconfig
+type TokenSource interface {
+	Token(ctx context.Context, config Config) (string, error)
+}
+
+// newTokenSource returns the -token-source with the given name
+func newTokenSource(name string, clientset *kubernetes.Clientset) (TokenSource, error) {
+	switch name {
+	case "serviceaccount":
+		return serviceAccountTokenSource{clientset: clientset}, nil
+	case "webhook":
+		return webhookTokenSource{client: http.DefaultClient}, nil
+	default:
+		return nil, fmt.Errorf("unsupported token source %q, expected serviceaccount or webhook", name)
+	}
+}
+
+// serviceAccountTokenSource mints the ServiceAccount's token through the cluster,
+// honoring -token-method
+type serviceAccountTokenSource struct {
+	clientset *kubernetes.Clientset
+}
+
+func (s serviceAccountTokenSource) Token(ctx context.Context, config Config) (string, error) {
+	return getServiceAccountToken(ctx, s.clientset, config)
+}
+
+// webhookTokenRequest is the body POSTed to the -token-url endpoint
+type webhookTokenRequest struct {
+	ServiceAccount    string   `json:"serviceAccount"`
+	Namespace         string   `json:"namespace"`
+	Audiences         []string `json:"audiences,omitempty"`
+	ExpirationSeconds int64    `json:"expirationSeconds"`
+}
+
+// webhookTokenResponse accepts both a plain {"token": ...} reply and an OAuth 2.0
+// token exchange (RFC 8693) reply
+type webhookTokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// webhookTokenSource exchanges the caller's token for a Kubernetes token at an
+// external endpoint, without using the ServiceAccount API
+type webhookTokenSource struct {
+	client *http.Client
+}
+
+func (s webhookTokenSource) Token(ctx context.Context, config Config) (string, error) {
+	body, err := json.Marshal(webhookTokenRequest{
+		ServiceAccount:    config.ServiceAccountName,
+		Namespace:         config.Namespace,
+		Audiences:         config.Audiences,
+		ExpirationSeconds: int64(config.TokenExpiryHours) * 3600,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	// Present the incoming (e.g. OIDC) token that is being exchanged
+	if config.TokenSubjectFile != "" {
+		subject, err := os.ReadFile(config.TokenSubjectFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read subject token: %w", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(subject)))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("token webhook request failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token webhook response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token webhook returned %s: %s", response.Status, strings.TrimSpace(string(data)))
+	}
+
+	var reply webhookTokenResponse
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return "", fmt.Errorf("failed to parse token webhook response: %w", err)
+	}
+	token := reply.Token
+	if token == "" {
+		token = reply.AccessToken
+	}
+	if err := validateToken(token); err != nil {
+		return "", fmt.Errorf("token webhook returned an invalid token: %w", err)
+	}
+	if err := checkTokenIssuer(token, config.ExpectedIssuer); err != nil {
+		return "", err
+	}
+	return token, nil
+}
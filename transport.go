@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// version is the tool version, set by the release workflow with -ldflags "-X main.version=v<release>"
+var version = "dev"
+
+// userAgent identifies this tool in API server audit logs
+func userAgent() string {
+	return fmt.Sprintf("kubeconfig-generator/%s", version)
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseHeaders parses key=value header flags into an http.Header
+func parseHeaders(values []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", value)
+		}
+		headers.Add(strings.TrimSpace(key), val)
+	}
+	return headers, nil
+}
+
+// headerRoundTripper adds extra headers to every request sent to the API server
+type headerRoundTripper struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range rt.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// requestSemaphore bounds concurrent API requests across all clientsets of this
+// process when -max-concurrent-requests is set
+var requestSemaphore struct {
+	once  sync.Once
+	slots chan struct{}
+}
+
+// requestSlots returns the process-wide request semaphore, sized on first use
+func requestSlots(size int) chan struct{} {
+	requestSemaphore.once.Do(func() {
+		requestSemaphore.slots = make(chan struct{}, size)
+	})
+	return requestSemaphore.slots
+}
+
+// semaphoreRoundTripper holds a semaphore slot for the duration of each request
+type semaphoreRoundTripper struct {
+	slots chan struct{}
+	next  http.RoundTripper
+}
+
+func (rt *semaphoreRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case rt.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	defer func() { <-rt.slots }()
+	return rt.next.RoundTrip(req)
+}
+
+// configureClient identifies this tool to the API server, injects any extra headers
+// and applies the concurrent request limit
+func configureClient(clientConfig *rest.Config, config Config) error {
+	clientConfig.UserAgent = userAgent()
+
+	if len(config.Headers) > 0 {
+		headers, err := parseHeaders(config.Headers)
+		if err != nil {
+			return err
+		}
+		clientConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &headerRoundTripper{headers: headers, next: rt}
+		})
+	}
+
+	if config.MaxConcurrent > 0 {
+		slots := requestSlots(config.MaxConcurrent)
+		clientConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &semaphoreRoundTripper{slots: slots, next: rt}
+		})
+	}
+
+	return nil
+}
+
+// useClientCertificate makes the minting client authenticate with -client-cert and
+// -client-key instead of whatever credentials the kubeconfig's user carries
+func useClientCertificate(clientConfig *rest.Config, config Config) {
+	if config.ClientCert == "" {
+		return
+	}
+	clientConfig.TLSClientConfig.CertFile = config.ClientCert
+	clientConfig.TLSClientConfig.KeyFile = config.ClientKey
+	clientConfig.TLSClientConfig.CertData = nil
+	clientConfig.TLSClientConfig.KeyData = nil
+
+	clientConfig.BearerToken = ""
+	clientConfig.BearerTokenFile = ""
+	clientConfig.Username = ""
+	clientConfig.Password = ""
+	clientConfig.ExecProvider = nil
+	clientConfig.AuthProvider = nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"kubeconfig-generator/kubetoken"
+)
+
+// kubeconfigUnchanged reports whether the kubeconfig at path matches newConfig in
+// everything but the tokens, and its tokens are still valid. When it does, the
+// existing tokens are copied into newConfig so what is reported matches the file.
+func kubeconfigUnchanged(path string, newConfig *api.Config) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read existing kubeconfig: %w", err)
+	}
+	existing, err := clientcmd.Load(data)
+	if err != nil {
+		// Whatever is there is not a kubeconfig, so replace it
+		return false, nil
+	}
+
+	for _, authInfo := range existing.AuthInfos {
+		if authInfo.Token == "" {
+			continue
+		}
+		if expired, _, err := kubetoken.Expired(authInfo.Token, time.Now()); err == nil && expired {
+			return false, nil
+		}
+	}
+
+	existingData, err := withoutTokens(existing)
+	if err != nil {
+		return false, err
+	}
+	newData, err := withoutTokens(newConfig)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(existingData, newData) {
+		return false, nil
+	}
+
+	for name, authInfo := range existing.AuthInfos {
+		newConfig.AuthInfos[name].Token = authInfo.Token
+	}
+	return true, nil
+}
+
+// withoutTokens serializes a copy of kubeconfig with its tokens cleared
+func withoutTokens(kubeconfig *api.Config) ([]byte, error) {
+	stripped := kubeconfig.DeepCopy()
+	for _, authInfo := range stripped.AuthInfos {
+		authInfo.Token = ""
+	}
+	data, err := clientcmd.Write(*stripped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce groups the bursts of events editors and tools emit when saving a file
+const watchDebounce = 500 * time.Millisecond
+
+// watchRetryBackoff is the first delay before retrying a failed regeneration; it
+// doubles with every further failure, up to the refresh interval
+const watchRetryBackoff = time.Minute
+
+// watchAndRegenerate regenerates the output whenever the source kubeconfig changes,
+// and re-mints the token once 80% of its lifetime has passed, until ctx is done
+func watchAndRegenerate(ctx context.Context, config Config) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch the directory so files replaced by rename are still noticed
+	source, err := filepath.Abs(config.KubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", config.KubeconfigPath, err)
+	}
+	if err := watcher.Add(filepath.Dir(source)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", source, err)
+	}
+
+	refreshInterval := time.Duration(config.TokenExpiryHours) * time.Hour * 8 / 10
+	refresh := time.NewTimer(refreshInterval)
+	defer refresh.Stop()
+
+	retryBackoff := watchRetryBackoff
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	logger.Infof("watch", "Watching %s for changes", source)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infof("watch", "Stopped watching %s", source)
+			logger.StrictError() // failed regenerations were already reported
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("file watcher closed")
+			}
+			if filepath.Clean(event.Name) == source && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce.Reset(watchDebounce)
+			}
+			continue
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("file watcher closed")
+			}
+			logger.Warnf("watch", "File watcher error: %v", err)
+			continue
+
+		case <-debounce.C:
+			logger.Infof("watch", "%s changed, regenerating", source)
+
+		case <-refresh.C:
+			logger.Infof("watch", "Token nearing expiry, regenerating")
+		}
+
+		// Watcher warnings promoted by -strict must not fail the regeneration
+		logger.StrictError()
+
+		// Look the server up again, it may have moved since the last generation
+		resetClusterCache()
+		// Mint a fresh token, the cached one is what is about to expire
+		resetTokenCache()
+
+		start := time.Now()
+		generator := NewGenerator(config)
+		err := generator.Generate(ctx)
+		recordGeneration(config, time.Since(start), err)
+		if err != nil {
+			// Retry sooner than the next refresh, so a transient failure does not let the token expire
+			logger.Warnf("watch", "Error regenerating kubeconfig, retrying in %s: %v", retryBackoff, err)
+			refresh.Reset(retryBackoff)
+			retryBackoff = min(retryBackoff*2, refreshInterval)
+			continue
+		}
+		retryBackoff = watchRetryBackoff
+		refresh.Reset(refreshInterval)
+		reportOutput(config, generator.Kubeconfig)
+	}
+}